@@ -0,0 +1,270 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// typeCache memoizes TYPE results for attrValidity. Listing a directory of
+// 1000 keys and then statting each of them used to cost 1 pipelined TYPE
+// batch plus 2000 EXISTS/TYPE round-trips from Lookup; with the cache the
+// lookups are served from the listing and only the batch remains.
+type typeCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]typeEntry
+	// swept is the entry count left by the last sweep of expired entries
+	swept int
+}
+
+type typeEntry struct {
+	t  string
+	at time.Time
+}
+
+func newTypeCache(ttl time.Duration) *typeCache {
+	return &typeCache{
+		ttl:     ttl,
+		entries: make(map[string]typeEntry),
+	}
+}
+
+func (c *typeCache) get(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if ok && time.Since(e.at) > c.ttl {
+		delete(c.entries, key)
+		ok = false
+	}
+	observeCache("type", ok)
+	return e.t, ok
+}
+
+func (c *typeCache) set(key, t string) {
+	if c == nil || t == "none" {
+		return
+	}
+
+	c.mu.Lock()
+	c.entries[key] = typeEntry{t: t, at: time.Now()}
+	if len(c.entries) > 2*c.swept+1024 {
+		// listings type every key they see, most are never looked up
+		// again and would otherwise stay forever
+		for k, e := range c.entries {
+			if time.Since(e.at) > c.ttl {
+				delete(c.entries, k)
+			}
+		}
+		c.swept = len(c.entries)
+	}
+	c.mu.Unlock()
+}
+
+func (c *typeCache) invalidate(key string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+}
+
+func (c *typeCache) clear() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.entries = make(map[string]typeEntry)
+	c.swept = 0
+	c.mu.Unlock()
+}
+
+// negativeCache remembers keys Lookup found missing for ttl, so shells
+// probing the same absent names during completion or PATH resolution do
+// not cost a round-trip each time.
+type negativeCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]time.Time
+	swept   int
+}
+
+// newNegativeCache returns nil, which caches nothing, for a ttl of 0.
+func newNegativeCache(ttl time.Duration) *negativeCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &negativeCache{
+		ttl:     ttl,
+		entries: make(map[string]time.Time),
+	}
+}
+
+func (c *negativeCache) get(key string) bool {
+	if c == nil {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	at, ok := c.entries[key]
+	if ok && time.Since(at) > c.ttl {
+		delete(c.entries, key)
+		ok = false
+	}
+	observeCache("negative", ok)
+	return ok
+}
+
+func (c *negativeCache) set(key string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.entries[key] = time.Now()
+	if len(c.entries) > 2*c.swept+1024 {
+		for k, at := range c.entries {
+			if time.Since(at) > c.ttl {
+				delete(c.entries, k)
+			}
+		}
+		c.swept = len(c.entries)
+	}
+	c.mu.Unlock()
+}
+
+func (c *negativeCache) invalidate(key string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+}
+
+func (c *negativeCache) clear() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.entries = make(map[string]time.Time)
+	c.swept = 0
+	c.mu.Unlock()
+}
+
+// contentCache keeps rendered file contents for up to ttl, evicting the
+// least recently used keys once the cached bytes exceed max.
+type contentCache struct {
+	max   int64
+	ttl   time.Duration
+	mu    sync.Mutex
+	size  int64
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type contentEntry struct {
+	key string
+	t   string
+	b   []byte
+	at  time.Time
+}
+
+// newContentCache returns nil, a disabled cache, when max is not positive.
+func newContentCache(max int64, ttl time.Duration) *contentCache {
+	if max <= 0 {
+		return nil
+	}
+	return &contentCache{
+		max:   max,
+		ttl:   ttl,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (c *contentCache) get(key string) (string, []byte, bool) {
+	if c == nil {
+		return "", nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if ok && time.Since(el.Value.(*contentEntry).at) > c.ttl {
+		c.remove(el)
+		ok = false
+	}
+	observeCache("content", ok)
+	if !ok {
+		return "", nil, false
+	}
+
+	c.ll.MoveToFront(el)
+	e := el.Value.(*contentEntry)
+	return e.t, e.b, true
+}
+
+func (c *contentCache) set(key, t string, b []byte) {
+	if c == nil || int64(len(b)) > c.max {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	c.items[key] = c.ll.PushFront(&contentEntry{key: key, t: t, b: b, at: time.Now()})
+	c.size += int64(len(b))
+
+	for c.size > c.max {
+		c.remove(c.ll.Back())
+	}
+}
+
+func (c *contentCache) invalidate(key string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	c.mu.Unlock()
+}
+
+func (c *contentCache) clear() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+	c.size = 0
+	c.mu.Unlock()
+}
+
+// remove drops el, the caller holds c.mu.
+func (c *contentCache) remove(el *list.Element) {
+	e := c.ll.Remove(el).(*contentEntry)
+	delete(c.items, e.key)
+	c.size -= int64(len(e.b))
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"bazil.org/fuse"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestContentCache(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	root := rootDir(t, rfs)
+	mr.RPush("l", "a", "b")
+
+	f := lookupFile(t, root, "l")
+	if got := readFile(t, f); got != "a\nb" {
+		t.Fatalf("first read = %q", got)
+	}
+
+	// a change behind the cache's back stays unseen within attrValidity
+	mr.RPush("l", "c")
+	if got := readFile(t, f); got != "a\nb" {
+		t.Fatalf("second read = %q, want the cached value", got)
+	}
+
+	h := open(t, f, fuse.OpenWriteOnly)
+	write(t, h, 0, "x\ny")
+	closeHandle(t, h)
+	if got := readFile(t, f); got != "x\ny" {
+		t.Fatalf("read after flush = %q", got)
+	}
+
+	if err := root.Remove(context.Background(), &fuse.RemoveRequest{Name: "l"}); err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	_, err := f.reloadFile(context.Background())
+	f.mu.Unlock()
+	if err == nil {
+		t.Fatal("read after remove was served from the cache")
+	}
+}
+
+func TestWatchMasters(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	cc := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{mr.Addr()}})
+	t.Cleanup(func() { cc.Close() })
+
+	ctx := context.Background()
+	watched := make(map[string]context.CancelFunc)
+	rfs.watchMasters(ctx, cc, watched)
+	if _, ok := watched[mr.Addr()]; !ok || len(watched) != 1 {
+		t.Fatalf("watched = %v, want only %s", watched, mr.Addr())
+	}
+
+	// a known master is not subscribed twice, a gone one is dropped
+	stale, cancelled := context.WithCancel(ctx)
+	watched["gone:6379"] = cancelled
+	rfs.watchMasters(ctx, cc, watched)
+	if len(watched) != 1 || stale.Err() == nil {
+		t.Fatalf("watched = %v after rescan, stale watcher cancelled: %v", watched, stale.Err() != nil)
+	}
+	for _, cancel := range watched {
+		cancel()
+	}
+}
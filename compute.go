@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// computeDirName is the synthetic root directory of set algebra results
+// with -enable-compute.
+const computeDirName = "__compute__"
+
+// computeDir resolves names of the form <op>:<key>[:<key>...] to read-only
+// files holding the result of SINTER, SUNION or SDIFF over those keys. Keys
+// are percent-decoded, so %3A stands for a ':' inside a key name, and keys
+// hidden by the filters or matching -readonly-keys are refused. Nothing is
+// stored and the directory lists as empty.
+type computeDir struct {
+	*redisFS
+}
+
+func (c *computeDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Valid = c.attrValidity
+	a.Mode = os.ModeDir | 0555
+	return nil
+}
+
+func (c *computeDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	return nil, nil
+}
+
+func (c *computeDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+
+	parts := strings.Split(name, ":")
+	if len(parts) < 2 {
+		return nil, syscall.ENOENT
+	}
+	keys := make([]string, len(parts)-1)
+	for i, p := range parts[1:] {
+		key, err := url.PathUnescape(p)
+		if err != nil || key == "" {
+			return nil, syscall.ENOENT
+		}
+		keys[i] = c.prefix + key
+		// the same keys a listing would hide stay out of reach here
+		if !c.visible(keys[i]) {
+			return nil, syscall.ENOENT
+		}
+		if c.protected(keys[i]) {
+			return nil, syscall.EACCES
+		}
+	}
+
+	var op func(ctx context.Context) ([]string, error)
+	switch parts[0] {
+	case "inter":
+		op = func(ctx context.Context) ([]string, error) { return c.client.SInter(ctx, keys...).Result() }
+	case "union":
+		op = func(ctx context.Context) ([]string, error) { return c.client.SUnion(ctx, keys...).Result() }
+	case "diff":
+		op = func(ctx context.Context) ([]string, error) { return c.client.SDiff(ctx, keys...).Result() }
+	default:
+		return nil, syscall.ENOENT
+	}
+
+	return &synthFile{
+		read: func(ctx context.Context) ([]byte, error) {
+			members, err := op(ctx)
+			if err != nil {
+				slog.Error("redis command failed", "op", "Read:S"+strings.ToUpper(parts[0]), "keys", keys, "err", err)
+				return nil, errno(err)
+			}
+			// read like a set key, sorted and one member per line
+			sort.Strings(members)
+			return []byte(strings.Join(members, "\n")), nil
+		},
+		redisFS: c.redisFS,
+	}, nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"syscall"
+	"testing"
+)
+
+func TestComputeFilters(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	rfs.prefix = "app:"
+	rfs.exclude = []string{"app:hidden"}
+	rfs.readonlyKeys = []string{"app:locked"}
+	for _, k := range []string{"app:a", "app:b", "app:hidden", "app:locked", "b"} {
+		mr.SAdd(k, "x")
+	}
+	c := &computeDir{redisFS: rfs}
+	ctx := context.Background()
+
+	if _, err := c.Lookup(ctx, "inter:a:b"); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]error{
+		"inter:a:hidden": syscall.ENOENT,
+		"union:locked":   syscall.EACCES,
+	} {
+		if _, err := c.Lookup(ctx, name); err != want {
+			t.Errorf("Lookup(%q) = %v, want %v", name, err, want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"syscall"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Open gives root listings a paging handle so huge keyspaces are listed one
+// SCAN batch at a time as the kernel asks for more, instead of being
+// collected in full first. Cluster listings, which merge all masters, and
+// namespace trees, which group keys across batches, keep using ReadDirAll.
+func (d *redisDir) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	if !d.root || d.separator != "" {
+		return d, nil
+	}
+	if _, ok := d.client.(*redis.ClusterClient); ok {
+		return d, nil
+	}
+	return &rootDirHandle{d: d}, nil
+}
+
+// rootDirHandle holds a SCAN cursor between directory reads. Keys SCAN
+// returns twice, which only happens while Redis rehashes, are listed twice.
+type rootDirHandle struct {
+	d *redisDir
+
+	mu     sync.Mutex
+	cursor uint64
+	done   bool
+	// buf holds encoded dirents not yet returned, starting at offset off
+	// of the directory stream
+	buf []byte
+	off uint64
+}
+
+func (h *rootDirHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) (err error) {
+	defer observeOp("readdir", &err)
+	ctx, span := startSpan(ctx, "ReadDir", h.d.prefix)
+	defer func() { endSpan(span, err, attribute.Int("rsfs.size", len(resp.Data))) }()
+
+	if !req.Dir {
+		return syscall.EISDIR
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if req.Offset == 0 {
+		// rewinddir(3) starts a fresh SCAN
+		h.cursor, h.done, h.buf, h.off = 0, false, nil, 0
+	}
+
+	skip := uint64(req.Offset) - h.off
+	if uint64(req.Offset) < h.off || skip > uint64(len(h.buf)) {
+		// seekdir(3) to anywhere but the current position
+		return syscall.EINVAL
+	}
+	h.buf, h.off = h.buf[skip:], h.off+skip
+
+	for len(h.buf) < req.Size && !h.done {
+		if err := h.fill(ctx); err != nil {
+			return err
+		}
+	}
+
+	// only whole entries may be returned
+	n := 0
+	for n < len(h.buf) {
+		l := direntLen(h.buf[n:])
+		if n+l > req.Size {
+			break
+		}
+		n += l
+	}
+	resp.Data = append(resp.Data, h.buf[:n]...)
+	h.buf, h.off = h.buf[n:], h.off+uint64(n)
+	return nil
+}
+
+// fill encodes the next SCAN batch, and the synthetic entries after the
+// last one.
+func (h *rootDirHandle) fill(ctx context.Context) error {
+
+	d := h.d
+	keys, next, err := d.client.Scan(ctx, h.cursor, globEscape(d.prefix)+"*", d.scanCount).Result()
+	if err != nil {
+		return errno(err)
+	}
+	entries, err := d.keyEntries(ctx, keys)
+	if err != nil {
+		return err
+	}
+
+	h.cursor = next
+	if next == 0 {
+		h.done = true
+		entries = append(entries, d.rootExtras()...)
+	}
+
+	end := h.off + uint64(len(h.buf))
+	for _, e := range entries {
+		e.Inode = d.GenerateInode(1, e.Name)
+		b := fuse.AppendDirent(nil, e)
+		// AppendDirent numbers offsets from the start of its own buffer
+		end += uint64(len(b))
+		binary.NativeEndian.PutUint64(b[8:16], end)
+		h.buf = append(h.buf, b...)
+	}
+	return nil
+}
+
+// direntLen is the encoded size of the fuse_dirent at the start of b: a
+// 24-byte header with the name length at offset 16, then the name padded to
+// 8 bytes.
+func direntLen(b []byte) int {
+	namelen := int(binary.NativeEndian.Uint32(b[16:20]))
+	return (24 + namelen + 7) &^ 7
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"syscall"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// dumpSuffix names the sidecar holding the DUMP of a key with -dump-files.
+// Sidecars are not listed, only looked up and created by name.
+const dumpSuffix = ".dump"
+
+// dumpFile reads as DUMP of key and RESTOREs what is written to it.
+type dumpFile struct {
+	key string
+	*redisFS
+}
+
+// Attr reports size 0 rather than serializing the key on every stat, the
+// handle is DirectIO so reads still return the whole dump.
+func (f *dumpFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Valid = f.attrValidity
+	a.Mode = f.fileMode
+	if f.readOnly || f.protected(f.key) {
+		a.Mode &^= 0222
+	}
+	return nil
+}
+
+func (f *dumpFile) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	// truncation is all O_TRUNC asks for, the key is only replaced on flush
+	return f.Attr(ctx, &resp.Attr)
+}
+
+func (f *dumpFile) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	if (f.readOnly || f.protected(f.key)) && !req.Flags.IsReadOnly() {
+		return nil, syscall.EROFS
+	}
+	resp.Flags |= fuse.OpenDirectIO
+	return &dumpHandle{f: f}, nil
+}
+
+type dumpHandle struct {
+	f     *dumpFile
+	mu    sync.Mutex
+	wb    []byte
+	dirty bool
+}
+
+func (h *dumpHandle) ReadAll(ctx context.Context) ([]byte, error) {
+	b, err := h.f.client.Dump(ctx, h.f.key).Bytes()
+	if err != nil {
+		return nil, errno(err)
+	}
+	return b, nil
+}
+
+func (h *dumpHandle) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	end := int(req.Offset) + len(req.Data)
+	if end > len(h.wb) {
+		h.wb = append(h.wb, make([]byte, end-len(h.wb))...)
+	}
+	copy(h.wb[req.Offset:], req.Data)
+	h.dirty = true
+	resp.Size = len(req.Data)
+	return nil
+}
+
+// Flush restores the written payload. An existing key is never replaced,
+// remove it first.
+func (h *dumpHandle) Flush(ctx context.Context, req *fuse.FlushRequest) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.dirty {
+		return nil
+	}
+
+	f := h.f
+	err := f.client.Restore(ctx, f.key, f.defaultTTL, string(h.wb)).Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYKEY") {
+		return syscall.EEXIST
+	}
+	if err != nil && strings.Contains(err.Error(), "payload version or checksum are wrong") {
+		// written by a newer Redis, or not a DUMP at all
+		slog.Error("redis command failed", "op", "Flush:Restore", "key", f.key, "err", err)
+		return syscall.EINVAL
+	}
+	if err != nil {
+		slog.Error("redis command failed", "op", "Flush:Restore", "key", f.key, "err", err)
+		return errno(err)
+	}
+
+	f.invalidate(f.key)
+	h.dirty = false
+	return nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"bazil.org/fuse"
+)
+
+func TestDumpAttr(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	mr.Set("k", "v")
+	f := &dumpFile{key: "k", redisFS: rfs}
+
+	before := mr.CommandCount()
+	var a fuse.Attr
+	if err := f.Attr(context.Background(), &a); err != nil {
+		t.Fatal(err)
+	}
+	if n := mr.CommandCount() - before; n != 0 {
+		t.Fatalf("stat sent %d commands", n)
+	}
+	if a.Size != 0 || a.Mode != rfs.fileMode {
+		t.Fatalf("attr = %v", a)
+	}
+}
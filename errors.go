@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"syscall"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// errno translates a Redis client error into the errno reported to the
+// kernel, so tools see why an operation failed instead of a bare EIO.
+func errno(err error) error {
+	if err == nil {
+		return nil
+	}
+	if err == redis.Nil {
+		return syscall.ENOENT
+	}
+	if err == context.Canceled {
+		return syscall.EINTR
+	}
+
+	msg := err.Error()
+	switch {
+	case strings.HasPrefix(msg, "WRONGTYPE"):
+		return syscall.ENOTSUP
+	case strings.HasPrefix(msg, "READONLY"):
+		// writes that reached a replica
+		return syscall.EROFS
+	case strings.HasPrefix(msg, "OOM"):
+		// maxmemory reached with a noeviction policy
+		return syscall.ENOSPC
+	case strings.HasPrefix(msg, "NOPERM"), strings.HasPrefix(msg, "NOAUTH"):
+		return syscall.EACCES
+	}
+	return syscall.EIO
+}
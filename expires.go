@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"sync"
+	"syscall"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// expiresSuffix names the sidecar showing when a key expires with
+// -expires-files. Sidecars are not listed, only looked up by name.
+const expiresSuffix = ".expires"
+
+// expiresFile reads as the RFC 3339 expiry time of key, or -1 if it does
+// not expire. Writing a time sets it with PEXPIREAT, writing -1 removes it.
+type expiresFile struct {
+	key string
+	*redisFS
+}
+
+func (f *expiresFile) read(ctx context.Context) ([]byte, error) {
+
+	at, err := f.client.PExpireTime(ctx, f.key).Result()
+	if err != nil {
+		return nil, errno(err)
+	}
+	switch at {
+	case -2:
+		return nil, syscall.ENOENT
+	case -1:
+		return []byte("-1\n"), nil
+	}
+	return []byte(time.UnixMilli(at.Milliseconds()).UTC().Format(time.RFC3339Nano) + "\n"), nil
+}
+
+func (f *expiresFile) Attr(ctx context.Context, a *fuse.Attr) error {
+
+	b, err := f.read(ctx)
+	if err != nil {
+		return err
+	}
+
+	a.Valid = f.attrValidity
+	a.Size = uint64(len(b))
+	a.Mode = f.fileMode
+	if f.readOnly || f.protected(f.key) {
+		a.Mode &^= 0222
+	}
+	return nil
+}
+
+func (f *expiresFile) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	// truncation is all O_TRUNC asks for, the expiry only changes on flush
+	return f.Attr(ctx, &resp.Attr)
+}
+
+func (f *expiresFile) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	if (f.readOnly || f.protected(f.key)) && !req.Flags.IsReadOnly() {
+		return nil, syscall.EROFS
+	}
+	resp.Flags |= fuse.OpenDirectIO
+	return &expiresHandle{f: f}, nil
+}
+
+type expiresHandle struct {
+	f     *expiresFile
+	mu    sync.Mutex
+	wb    []byte
+	dirty bool
+}
+
+func (h *expiresHandle) ReadAll(ctx context.Context) ([]byte, error) {
+	return h.f.read(ctx)
+}
+
+func (h *expiresHandle) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	end := int(req.Offset) + len(req.Data)
+	if end > len(h.wb) {
+		h.wb = append(h.wb, make([]byte, end-len(h.wb))...)
+	}
+	copy(h.wb[req.Offset:], req.Data)
+	h.dirty = true
+	resp.Size = len(req.Data)
+	return nil
+}
+
+// Flush applies the written expiry. Anything but -1 or a future RFC 3339
+// time fails with EINVAL and leaves the TTL alone, a past time would
+// delete the key.
+func (h *expiresHandle) Flush(ctx context.Context, req *fuse.FlushRequest) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.dirty {
+		return nil
+	}
+
+	f := h.f
+	v := string(bytes.TrimSpace(h.wb))
+
+	// PERSIST also reports false for keys that never expired, only
+	// PEXPIREAT tells a missing key apart
+	ok := true
+	var err error
+	if v == "-1" {
+		err = f.client.Persist(ctx, f.key).Err()
+	} else {
+		at, perr := time.Parse(time.RFC3339Nano, v)
+		if perr != nil || !at.After(time.Now()) {
+			return syscall.EINVAL
+		}
+		ok, err = f.client.PExpireAt(ctx, f.key, at).Result()
+	}
+	if err != nil {
+		slog.Error("redis command failed", "op", "Flush:PExpireAt", "key", f.key, "err", err)
+		return errno(err)
+	}
+	if !ok {
+		return syscall.ENOENT
+	}
+
+	h.dirty = false
+	return nil
+}
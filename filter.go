@@ -0,0 +1,108 @@
+package main
+
+// visible reports whether key is listed and looked up at all: metadata
+// hashes are hidden, as is anything -exclude matches or -include does not.
+func (rfs *redisFS) visible(key string) bool {
+
+	if rfs.persistMeta && isMetaKey(key) {
+		return false
+	}
+	for _, p := range rfs.exclude {
+		if globMatch(p, key) {
+			return false
+		}
+	}
+	if len(rfs.include) == 0 {
+		return true
+	}
+	for _, p := range rfs.include {
+		if globMatch(p, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// protected reports whether -readonly-keys keeps key from being changed on
+// an otherwise writable mount.
+func (rfs *redisFS) protected(key string) bool {
+	for _, p := range rfs.readonlyKeys {
+		if globMatch(p, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// globMatch matches s against a glob the way Redis does for KEYS and SCAN
+// MATCH: * and ? match any bytes including '/', [...] takes ranges and a
+// leading ^ to negate, and \ quotes the next byte.
+func globMatch(p, s string) bool {
+
+	for len(p) > 0 {
+		switch p[0] {
+		case '*':
+			for len(p) > 1 && p[1] == '*' {
+				p = p[1:]
+			}
+			if len(p) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if globMatch(p[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			p = p[1:]
+			not := len(p) > 0 && p[0] == '^'
+			if not {
+				p = p[1:]
+			}
+			match := false
+			for len(p) > 0 && p[0] != ']' {
+				switch {
+				case p[0] == '\\' && len(p) > 1:
+					match = match || p[1] == s[0]
+					p = p[2:]
+				case len(p) > 2 && p[1] == '-' && p[2] != ']':
+					lo, hi := p[0], p[2]
+					if lo > hi {
+						lo, hi = hi, lo
+					}
+					match = match || (s[0] >= lo && s[0] <= hi)
+					p = p[3:]
+				default:
+					match = match || p[0] == s[0]
+					p = p[1:]
+				}
+			}
+			if match == not {
+				return false
+			}
+			if len(p) == 0 {
+				// unterminated class, like Redis take it as closed
+				return len(s) == 1
+			}
+		case '\\':
+			if len(p) > 1 {
+				p = p[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || p[0] != s[0] {
+				return false
+			}
+		}
+		p, s = p[1:], s[1:]
+	}
+	return len(s) == 0
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestGlobMatch(t *testing.T) {
+	for _, c := range []struct {
+		p, s string
+		want bool
+	}{
+		{"*", "", true},
+		{"*", "a/b", true},
+		{"a*c", "abbbc", true},
+		{"a*c", "abcd", false},
+		{"a**", "a", true},
+		{"?", "", false},
+		{"?", "/", true},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"[a-c]", "b", true},
+		{"[c-a]", "b", true},
+		{"[abc]", "", false},
+		{"[^a-c]", "d", true},
+		{"[^a-c]", "b", false},
+		{"[^a-c]x", "dx", true},
+		{`\*`, "*", true},
+		{`\*`, "a", false},
+		{`a\?`, "a?", true},
+		{`a\?`, "ab", false},
+		{`[\]]`, "]", true},
+		{`[\^a]`, "^", true},
+		{`a\`, `a\`, true},
+		{"[abc", "a", true},
+		{"[abc", "d", false},
+		{"[abc", "ab", false},
+		{"x[a", "xa", true},
+	} {
+		if got := globMatch(c.p, c.s); got != c.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", c.p, c.s, got, c.want)
+		}
+	}
+}
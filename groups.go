@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"sort"
+	"strings"
+	"syscall"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// groupsDirName is the synthetic directory inside every stream directory
+// exposing its consumer groups as groups/<group>/<consumer>.
+const groupsDirName = "groups"
+
+// ackFileName is the control file inside a group directory; writing
+// whitespace-separated entry IDs to it XACKs them.
+const ackFileName = "ack"
+
+type groupsDir struct {
+	stream string
+	*redisFS
+}
+
+func (g *groupsDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Valid = g.attrValidity
+	a.Mode = g.dirAttrMode()
+	return nil
+}
+
+func (g *groupsDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+
+	groups, err := groupNames(ctx, g.client, g.stream)
+	if err != nil {
+		slog.Error("redis command failed", "op", "Lookup:XInfoGroups", "key", g.stream, "err", err)
+		return nil, errno(err)
+	}
+	for _, grp := range groups {
+		if grp == name {
+			return &groupDir{stream: g.stream, group: name, redisFS: g.redisFS}, nil
+		}
+	}
+
+	return nil, syscall.ENOENT
+}
+
+func (g *groupsDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+
+	groups, err := groupNames(ctx, g.client, g.stream)
+	if err != nil {
+		slog.Error("redis command failed", "op", "ReadDirAll:XInfoGroups", "key", g.stream, "err", err)
+		return nil, errno(err)
+	}
+
+	entries := make([]fuse.Dirent, len(groups))
+	for i := range groups {
+		entries[i].Name = groups[i]
+		entries[i].Type = fuse.DT_Dir
+	}
+	return entries, nil
+}
+
+// Mkdir creates a consumer group that starts at the end of the stream, so
+// only entries added afterwards are delivered, as with XGROUP CREATE ... $.
+func (g *groupsDir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error) {
+	if g.readOnly || g.protected(g.stream) {
+		return nil, syscall.EROFS
+	}
+
+	_, err := g.client.XGroupCreate(ctx, g.stream, req.Name, "$").Result()
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return nil, syscall.EEXIST
+		}
+		slog.Error("redis command failed", "op", "Mkdir:XGroupCreate", "key", g.stream, "group", req.Name, "err", err)
+		return nil, errno(err)
+	}
+
+	return &groupDir{stream: g.stream, group: req.Name, redisFS: g.redisFS}, nil
+}
+
+type groupDir struct {
+	stream string
+	group  string
+	*redisFS
+}
+
+func (g *groupDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Valid = g.attrValidity
+	a.Mode = g.dirAttrMode()
+	return nil
+}
+
+// Lookup accepts any consumer name, Redis creates consumers on first read.
+func (g *groupDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	if name == ackFileName {
+		return &ackFile{groupDir: g}, nil
+	}
+	return &consumerFile{groupDir: g, consumer: name}, nil
+}
+
+func (g *groupDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+
+	consumers, err := consumerNames(ctx, g.client, g.stream, g.group)
+	if err != nil {
+		slog.Error("redis command failed", "op", "ReadDirAll:XInfoConsumers", "key", g.stream, "group", g.group, "err", err)
+		return nil, errno(err)
+	}
+
+	entries := []fuse.Dirent{{Name: ackFileName, Type: fuse.DT_File}}
+	for _, c := range consumers {
+		if c == ackFileName {
+			continue
+		}
+		entries = append(entries, fuse.Dirent{Name: c, Type: fuse.DT_File})
+	}
+	return entries, nil
+}
+
+// consumerFile reads as the entries pending for one consumer of a group.
+// Every read first claims new entries with XREADGROUP >, so reading again
+// returns the same entries until they are acknowledged through ack.
+type consumerFile struct {
+	*groupDir
+	consumer string
+}
+
+func (c *consumerFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	// the size is unknown without claiming entries, direct IO reads to EOF
+	a.Valid = c.attrValidity
+	a.Mode = 0444
+	return nil
+}
+
+func (c *consumerFile) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	resp.Flags |= fuse.OpenDirectIO
+	return c, nil
+}
+
+func (c *consumerFile) ReadAll(ctx context.Context) (b []byte, err error) {
+	defer observeOp("readgroup", &err)
+	ctx, span := startSpan(ctx, "ReadAll", c.stream)
+	defer func() { endSpan(span, err, attribute.Int("rsfs.size", len(b))) }()
+
+	// claiming moves the group's cursor, only list what is pending if the
+	// stream may not change
+	if !c.readOnly && !c.protected(c.stream) {
+		_, err = c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    c.group,
+			Consumer: c.consumer,
+			Streams:  []string{c.stream, ">"},
+			Count:    c.scanCount,
+			Block:    -1,
+		}).Result()
+		if err != nil && err != redis.Nil {
+			slog.Error("redis command failed", "op", "Read:XReadGroup", "key", c.stream, "group", c.group, "consumer", c.consumer, "err", err)
+			return nil, errno(err)
+		}
+	}
+
+	streams, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    c.group,
+		Consumer: c.consumer,
+		Streams:  []string{c.stream, "0"},
+		Block:    -1,
+	}).Result()
+	if err != nil && err != redis.Nil {
+		slog.Error("redis command failed", "op", "Read:XReadGroup", "key", c.stream, "group", c.group, "consumer", c.consumer, "err", err)
+		return nil, errno(err)
+	}
+
+	msgs := []redis.XMessage{}
+	if len(streams) > 0 {
+		msgs = streams[0].Messages
+	}
+	return c.marshalStream(msgs)
+}
+
+// ackFile acknowledges the entry IDs written to it when the file is flushed.
+type ackFile struct {
+	*groupDir
+}
+
+func (a *ackFile) Attr(ctx context.Context, attr *fuse.Attr) error {
+	attr.Valid = a.attrValidity
+	attr.Mode = 0200
+	return nil
+}
+
+func (a *ackFile) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	// allow O_TRUNC and shell redirection, there is nothing to truncate
+	return nil
+}
+
+func (a *ackFile) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	if req.Flags.IsReadOnly() {
+		return nil, syscall.EACCES
+	}
+	if a.immutable() {
+		return nil, syscall.EPERM
+	}
+	resp.Flags |= fuse.OpenDirectIO
+	return &ackHandle{a: a}, nil
+}
+
+// immutable reports whether acknowledging is refused, on a read-only mount
+// or for a stream matching -readonly-keys.
+func (a *ackFile) immutable() bool {
+	return a.readOnly || a.protected(a.stream)
+}
+
+type ackHandle struct {
+	a   *ackFile
+	buf bytes.Buffer
+}
+
+func (h *ackHandle) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	h.buf.Write(req.Data)
+	resp.Size = len(req.Data)
+	return nil
+}
+
+func (h *ackHandle) Flush(ctx context.Context, req *fuse.FlushRequest) (err error) {
+	defer observeOp("ack", &err)
+
+	ids := strings.Fields(h.buf.String())
+	h.buf.Reset()
+	if len(ids) == 0 {
+		return nil
+	}
+	if h.a.immutable() {
+		return syscall.EPERM
+	}
+
+	_, err = h.a.client.XAck(ctx, h.a.stream, h.a.group, ids...).Result()
+	if err != nil {
+		slog.Error("redis command failed", "op", "Flush:XAck", "key", h.a.stream, "group", h.a.group, "err", err)
+		return errno(err)
+	}
+	return nil
+}
+
+// groupNames returns the sorted names of the consumer groups of stream.
+func groupNames(ctx context.Context, c redis.UniversalClient, stream string) ([]string, error) {
+
+	groups, err := c.XInfoGroups(ctx, stream).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(groups))
+	for _, g := range groups {
+		names = append(names, g.Name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// consumerNames returns the sorted names of the consumers in group.
+func consumerNames(ctx context.Context, c redis.UniversalClient, stream, group string) ([]string, error) {
+
+	consumers, err := c.XInfoConsumers(ctx, stream, group).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(consumers))
+	for _, c := range consumers {
+		names = append(names, c.Name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+
+	"bazil.org/fuse"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestAckReadonly(t *testing.T) {
+	for _, protect := range []func(*redisFS){
+		func(rfs *redisFS) { rfs.readOnly = true },
+		func(rfs *redisFS) { rfs.readonlyKeys = []string{"s"} },
+	} {
+		rfs, mr := newTestFS(t)
+		mr.XAdd("s", "1-1", []string{"a", "1"})
+		ctx := context.Background()
+		if err := rfs.client.XGroupCreate(ctx, "s", "g", "0").Err(); err != nil {
+			t.Fatal(err)
+		}
+		if err := rfs.client.XReadGroup(ctx, &redis.XReadGroupArgs{Group: "g", Consumer: "c", Streams: []string{"s", ">"}}).Err(); err != nil {
+			t.Fatal(err)
+		}
+		protect(rfs)
+
+		ack := &ackFile{groupDir: &groupDir{stream: "s", group: "g", redisFS: rfs}}
+		if _, err := ack.Open(ctx, &fuse.OpenRequest{Flags: fuse.OpenWriteOnly}, &fuse.OpenResponse{}); err != syscall.EPERM {
+			t.Fatalf("open ack = %v, want EPERM", err)
+		}
+		h := &ackHandle{a: ack}
+		h.buf.WriteString("1-1\n")
+		if err := h.Flush(ctx, &fuse.FlushRequest{}); err != syscall.EPERM {
+			t.Fatalf("flush ack = %v, want EPERM", err)
+		}
+		if p, err := rfs.client.XPending(ctx, "s", "g").Result(); err != nil || p.Count != 1 {
+			t.Fatalf("pending = %v, %v", p, err)
+		}
+	}
+}
+
+func TestGroupDirMode(t *testing.T) {
+	rfs, _ := newTestFS(t)
+	rfs.dirMode = 0750
+	for _, n := range []interface {
+		Attr(context.Context, *fuse.Attr) error
+	}{
+		&groupsDir{stream: "s", redisFS: rfs},
+		&groupDir{stream: "s", group: "g", redisFS: rfs},
+	} {
+		var a fuse.Attr
+		if err := n.Attr(context.Background(), &a); err != nil {
+			t.Fatal(err)
+		}
+		if a.Mode != os.ModeDir|0750 {
+			t.Fatalf("%T mode = %v", n, a.Mode)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/redis/go-redis/v9"
+)
+
+// listIndex parses the name of an element file of a list directory, only
+// the canonical decimal form of a non-negative index is accepted.
+func listIndex(name string) (int64, bool) {
+	i, err := strconv.ParseInt(name, 10, 64)
+	if err != nil || i < 0 || strconv.FormatInt(i, 10) != name {
+		return 0, false
+	}
+	return i, true
+}
+
+// readListDir lists a list shown as a directory with -list-as-dir, one file
+// per index.
+func (d *redisDir) readListDir(ctx context.Context) ([]fuse.Dirent, error) {
+
+	n, err := d.client.LLen(ctx, d.name).Result()
+	if err != nil {
+		return nil, errno(err)
+	}
+
+	entries := make([]fuse.Dirent, n)
+	for i := range entries {
+		entries[i].Name = strconv.Itoa(i)
+		entries[i].Type = fuse.DT_File
+	}
+	return entries, nil
+}
+
+func (d *redisDir) lookupListElem(ctx context.Context, name string) (fs.Node, error) {
+
+	i, ok := listIndex(name)
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	_, err := d.client.LIndex(ctx, d.name, i).Result()
+	if err == redis.Nil {
+		return nil, syscall.ENOENT
+	}
+	if err != nil {
+		return nil, errno(err)
+	}
+
+	return d.file(&redisFile{
+		name:    name,
+		parent:  d.name,
+		pt:      "list",
+		redisFS: d.redisFS,
+	}), nil
+}
+
+// setListElem writes back an element file with LSET, indexes past the end
+// of the list fail with ENOENT rather than growing it.
+func (f *redisFile) setListElem(ctx context.Context, wb []byte) error {
+
+	i, ok := listIndex(f.name)
+	if !ok {
+		return syscall.ENOENT
+	}
+	err := f.client.LSet(ctx, f.parent, i, wb).Err()
+	if err != nil && (strings.Contains(err.Error(), "index out of range") || strings.Contains(err.Error(), "no such key")) {
+		return syscall.ENOENT
+	}
+	if err != nil {
+		slog.Error("redis command failed", "op", "Flush:LSet", "key", f.parent, "index", i, "err", err)
+		return errno(err)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"syscall"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// keyVersion identifies the value a handle started from, so a flush can
+// tell whether another writer replaced it in the meantime.
+type keyVersion struct {
+	exists bool
+	sum    string
+}
+
+// digestScript returns the SHA1 of a string key, or nil if it does not
+// exist, so versions are taken without transferring the value.
+var digestScript = redis.NewScript(`
+local v = redis.call('GET', KEYS[1])
+if not v then return false end
+return redis.sha1hex(v)
+`)
+
+// digest returns the version of key as held by Redis.
+func digest(ctx context.Context, c redis.Scripter, key string) (*keyVersion, error) {
+	sum, err := digestScript.Run(ctx, c, []string{key}).Text()
+	if err == redis.Nil {
+		return &keyVersion{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &keyVersion{exists: true, sum: sum}, nil
+}
+
+// versionOf returns the version of a key holding b.
+func versionOf(b []byte) *keyVersion {
+	sum := sha1.Sum(b)
+	return &keyVersion{exists: true, sum: hex.EncodeToString(sum[:])}
+}
+
+var errConflict = errors.New("key changed since open")
+
+var errTypeChanged = errors.New("key changed type since lookup")
+
+// snapshot records the digest of the string key behind a writable handle
+// with -optimistic-locking.
+func (h *redisHandle) snapshot(ctx context.Context) error {
+
+	f := h.f
+	v, err := digest(ctx, f.client, f.name)
+	if err != nil {
+		slog.Error("redis command failed", "op", "Open:Digest", "key", f.name, "err", err)
+		return errno(err)
+	}
+	h.base = v
+	return nil
+}
+
+// compareAndSet stores wb only if the key still holds the value seen at
+// open, failing with EAGAIN otherwise. The caller holds h.mu.
+func (h *redisHandle) compareAndSet(ctx context.Context, wb []byte) error {
+
+	f := h.f
+	err := f.client.Watch(ctx, func(tx *redis.Tx) error {
+		cur, err := digest(ctx, tx, f.name)
+		if err != nil {
+			return err
+		}
+		if *cur != *h.base {
+			return errConflict
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, f.name, wb, 0)
+			return nil
+		})
+		return err
+	}, f.name)
+	if err == errConflict || err == redis.TxFailedErr {
+		slog.Warn("write conflict", "op", "Flush:Watch", "key", f.name)
+		return syscall.EAGAIN
+	}
+	if err != nil {
+		slog.Error("redis command failed", "op", "Flush:Watch", "key", f.name, "err", err)
+		return errno(err)
+	}
+
+	// later flushes of this handle build on what it just wrote
+	h.base = versionOf(wb)
+	return nil
+}
+
+// knownType returns the type the kernel was last shown for the key behind
+// id, from its node or the type cache, or "" if neither remembers it.
+func (rfs *redisFS) knownType(id fileID) string {
+
+	rfs.nodeMu.Lock()
+	f := rfs.files[id]
+	rfs.nodeMu.Unlock()
+	if f != nil {
+		f.mu.RLock()
+		t := f.t
+		f.mu.RUnlock()
+		if t != "" {
+			return t
+		}
+	}
+	t, _ := rfs.types.get(id.name)
+	return t
+}
+
+// safeDel deletes key with -safe-delete only if it still is what was
+// removed: a directory for rmdir and a file for unlink, of type want unless
+// that is "". Otherwise, or if the key changes meanwhile, it fails with
+// errTypeChanged or redis.TxFailedErr.
+func (rfs *redisFS) safeDel(ctx context.Context, key string, dir bool, want string) (int64, error) {
+
+	var n int64
+	err := rfs.client.Watch(ctx, func(tx *redis.Tx) error {
+		t, err := tx.Type(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if t == "none" {
+			return nil
+		}
+		if rfs.isDir(t) != dir || (want != "" && t != want) {
+			return errTypeChanged
+		}
+		cmds, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		n = cmds[0].(*redis.IntCmd).Val()
+		return nil
+	}, key)
+	return n, err
+}
@@ -1,22 +1,144 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
-	"net/http"
+	"log/slog"
+	"net"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
 	_ "bazil.org/fuse/fs/fstestutil" // needed if fuse.debug is used
+	"github.com/redis/go-redis/v9"
 )
 
 var (
-	fileName string
+	scanCount      = flag.Int64("scan-count", 1000, "COUNT hint for each SCAN batch when listing keys")
+	skipErrors     = flag.Bool("skip-errors", false, "list keys whose TYPE failed as unknown entries instead of failing the whole listing")
+	readOnly       = flag.Bool("ro", false, "mount read-only, rejecting all writes")
+	maxWriteBuffer = flag.Int64("max-write-buffer", 512<<20, "bytes a single open file may buffer before flush, larger writes fail with EFBIG (0 is unlimited)")
+	writeThrough   = flag.Int64("write-through-size", 8<<20, "once a string file written through one open grows past this many bytes, send each write with SETRANGE instead of buffering until flush (0 always buffers)")
+	writeCoalesce  = flag.Duration("write-coalesce", 0, "merge contiguous writes past -write-through-size arriving within this window into one SETRANGE, sent at the latest on close (0 sends each write)")
+	popOnRead      = flag.Bool("pop-on-read", false, "DESTRUCTIVE: reading a list pops its head element and reading a string deletes it (GETDEL), for work-queue consumers")
+	optimistic     = flag.Bool("optimistic-locking", false, "fail flush and close of a string file with EAGAIN if another client changed the key since it was opened; reopen, reapply and write again to retry")
+	safeDelete     = flag.Bool("safe-delete", false, "remove a key only if it is still of the type last shown (and a directory for rmdir, a file for rm), checked with WATCH; fail with EAGAIN otherwise")
+	noClobber      = flag.Bool("rename-no-clobber", false, "fail renames onto an existing key or field with EEXIST instead of overwriting it, like mv -n")
+	noCommit       = flag.Bool("no-commit", false, "accept writes but discard them on flush instead of sending them to redis (dry run)")
+
+	rootKey      = flag.String("key", "", "mount only this key: a hash or stream as the root directory, any other type as a single file on a file mountpoint")
+	separator    = flag.String("separator", "", "split key names on this delimiter into nested directories, e.g. ':' shows app:user:1 as app/user/1")
+	prefix       = flag.String("prefix", "", "only expose keys under this prefix, shown with the prefix stripped")
+	escapeKeys   = flag.Bool("escape-keys", false, "percent-encode '/', '%', NUL and newline in key names so any key is reachable")
+	compute      = flag.Bool("enable-compute", false, "serve set algebra under "+computeDirName+"/, e.g. cat "+computeDirName+"/inter:a:b prints SINTER a b (ops: inter, union, diff)")
+	enablePubsub = flag.Bool("enable-pubsub", false, "expose pub/sub channels as files under "+channelsDirName+"/: reading subscribes, each written line is published")
+	enableRejson = flag.Bool("enable-rejson", false, "read and write RedisJSON documents, shown as <key>.json files and pretty-printed (needs the RedisJSON module)")
+	dumpFiles    = flag.Bool("dump-files", false, "reading <key>.dump returns DUMP of key, writing a new one RESTOREs it; the format only loads into the same or a newer redis version")
+	expiresFiles = flag.Bool("expires-files", false, "<key>.expires reads as the key's expiry time (RFC 3339, -1 for none) and writing a time or -1 sets or removes it")
+	typeSuffix   = flag.Bool("type-suffix", false, "show list, set and zset keys with a .list, .set or .zset suffix so ls tells them apart from strings")
+
+	listFormat   = flag.String("list-format", "lines", "how lists are rendered and written back: lines (one element per line) or json (an array of strings, safe for elements containing newlines)")
+	hashFormat   = flag.String("hash-format", "dir", "how hashes are shown: dir (a directory with a file per field) or json (one <key>.json file holding all fields, replaced wholesale on write)")
+	listAsDir    = flag.Bool("list-as-dir", false, "show lists as directories with one file per index, read with LINDEX and written back with LSET")
+	listPush     = flag.String("list-push", "right", "where lines appended to a list (>>) go: right (RPUSH, FIFO with -pop-on-read) or left (LPUSH, LIFO)")
+	streamFormat = flag.String("stream-format", "json", "how streams are rendered: json, json-pretty or ndjson (one message per line)")
+
+	streamMaxLen    = flag.Int64("stream-maxlen", 0, "trim streams to at most this many entries when writing to them (0 disables trimming)")
+	streamMaxApprox = flag.Bool("stream-maxlen-approx", false, "trim with MAXLEN ~, cheaper but may keep a few extra entries")
+
+	tailBlock = flag.Duration("tail-block", 30*time.Second, "how long a read of <stream>/.tail waits for new entries before returning EOF (0 waits forever)")
+
+	debug     = flag.Bool("debug", false, "log every FUSE request and response, implies -log-level debug")
+	logLevel  = flag.String("log-level", "info", "minimum level of logged messages: debug, info, warn or error")
+	logFormat = flag.String("log-format", "text", "log output format: text or json")
+
+	metricsAddr  = flag.String("metrics-addr", ":8888", "listen address of the HTTP server exposing /metrics")
+	otelEndpoint = flag.String("otel-endpoint", "", "OTLP/HTTP collector URL, e.g. http://localhost:4318, to export traces of FUSE operations and redis commands to (empty disables tracing)")
+	controlToken = flag.String("control-token", "", "bearer token required by the HTTP control endpoints (empty disables the check)")
+
+	dirMode         = flag.String("dir-mode", "0555", "permission bits of the root, namespace, hash, stream and consumer group directories, in octal (write bits are dropped with -ro); 0755 lets file managers that check them create entries")
+	fileMode        = flag.String("file-mode", "0644", "permission bits of files backed by keys, in octal (write bits are dropped with -ro)")
+	persistMetadata = flag.Bool("persist-metadata", false, "store chmod/chown results in "+metaPrefix+"<key> hashes and report them back (not enforced)")
+	mountTimeout    = flag.Duration("mount-timeout", 0, "exit with an error, unmounting again, if the mount is not ready within this long (0 waits forever)")
+	allowOther      = flag.Bool("allow-other", false, "let other users access the mount (requires user_allow_other in /etc/fuse.conf)")
+
+	attrValidity  = flag.Duration("attr-validity", time.Second, "how long the kernel and rsfs cache attributes and key types; higher means fewer redis round-trips but staler views of keys changed by other clients")
+	watchKeyspace = flag.Bool("watch-keyspace", false, "invalidate caches from keyspace notifications (requires notify-keyspace-events on the server)")
+	negativeTTL   = flag.Duration("negative-ttl", time.Second, "how long a lookup of a missing key is answered with ENOENT without asking redis again; creating the key through the mount ends it early (0 disables)")
+	readCacheSize = flag.Int64("read-cache-size", 32<<20, "bytes of rendered key contents cached for up to -attr-validity (0 disables the cache)")
+	touchTTL      = flag.Duration("touch-ttl", 0, "reset the expiry of string keys to this on every read (EXPIRE), for sliding-expiry caches (0 leaves TTLs alone)")
+	defaultTTL    = flag.Duration("default-ttl", 0, "expiry applied to keys written through the mount (0 keeps them persistent)")
+
+	redisDB   = flag.Int("redis-db", 0, "redis logical database to mount (not supported in cluster mode)")
+	redisUser = flag.String("redis-user", "", "redis ACL username")
+	redisPass = flag.String("redis-pass", "", "redis password (defaults to $REDIS_PASSWORD)")
+
+	redisTLS           = flag.Bool("redis-tls", false, "connect to redis over TLS using the system cert pool")
+	redisCA            = flag.String("redis-ca", "", "PEM file with a custom CA for redis TLS")
+	redisCert          = flag.String("redis-cert", "", "PEM client certificate for redis TLS")
+	redisKey           = flag.String("redis-key", "", "PEM client key for redis TLS")
+	redisTLSSkipVerify = flag.Bool("redis-tls-skip-verify", false, "INSECURE: skip redis TLS certificate verification (dev only)")
+
+	redisCluster        = flag.Bool("redis-cluster", false, "use redis cluster mode even with a single seed endpoint")
+	redisRouteByLatency = flag.Bool("redis-route-by-latency", false, "cluster: route read-only commands to the closest master or replica")
+	redisRouteRandomly  = flag.Bool("redis-route-randomly", false, "cluster: route read-only commands to a random master or replica")
+	redisReadReplica    = flag.Bool("read-from-replica", false, "cluster and sentinel: send read-only commands to replicas, writes stay on the master (reads may lag behind writes)")
+
+	redisPoolSize     = flag.Int("redis-pool-size", 0, "max connections per redis node (0 uses 10 per CPU); raise it for parallel ls/cat against a remote redis")
+	redisMinIdle      = flag.Int("redis-min-idle", 0, "idle connections kept open per redis node to avoid dial latency on bursts")
+	redisDialTimeout  = flag.Duration("redis-dial-timeout", 0, "timeout for establishing redis connections (0 uses 5s)")
+	redisReadTimeout  = flag.Duration("redis-read-timeout", 0, "timeout for redis replies (0 uses 3s, -1 disables)")
+	redisWriteTimeout = flag.Duration("redis-write-timeout", 0, "timeout for sending redis commands (0 uses the read timeout)")
+
+	redisRetries         = flag.Int("redis-retries", 3, "retries of a redis command after network errors and timeouts, with jittered exponential backoff; logical errors like WRONGTYPE are never retried")
+	redisMaxRetryBackoff = flag.Duration("redis-max-retry-backoff", 0, "upper bound of the backoff between retries (0 uses 512ms); raise it to ride out failovers")
+
+	redisSocket     = flag.String("redis-socket", "", "connect to redis over this unix domain socket instead of TCP")
+	redisMasterName = flag.String("redis-master-name", "", "sentinel master name, requires -redis-sentinel")
+
+	redisAddrs     stringList
+	redisSentinels stringList
+
+	include stringList
+	exclude stringList
+
+	readonlyKeys stringList
 )
 
+func init() {
+	flag.Var(&redisAddrs, "redis", "redis endpoint(s) as host:port, comma-separated or repeated for cluster (default 127.0.0.1:6379)")
+	flag.Var(&redisSentinels, "redis-sentinel", "sentinel endpoint(s) as host:port, comma-separated or repeated")
+	flag.Var(&include, "include", "only show keys matching these Redis-style globs (as in SCAN MATCH), comma-separated or repeated")
+	flag.Var(&exclude, "exclude", "hide keys matching these Redis-style globs, e.g. 'celery-*', comma-separated or repeated; wins over -include")
+	flag.Var(&readonlyKeys, "readonly-keys", "refuse writes, truncation, removal and renames of keys matching these Redis-style globs with EROFS, e.g. 'config:*', comma-separated or repeated")
+}
+
+// stringList is a flag.Value collecting comma-separated and repeated values.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, s)
+		}
+	}
+	return nil
+}
+
 func usage() {
 	fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, "  %s MOUNTPOINT\n", os.Args[0])
@@ -27,35 +149,214 @@ func main() {
 	flag.Usage = usage
 	flag.Parse()
 
+	logger, err := newLogger(*logLevel, *logFormat, *debug)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// also routes the log package through logger
+	slog.SetDefault(logger)
+
 	if flag.NArg() < 1 {
 		usage()
 		os.Exit(2)
 	}
 	mountpoint := flag.Arg(0)
 
-	c, err := fuse.Mount(
-		mountpoint,
+	if *listFormat != "lines" && *listFormat != "json" {
+		log.Fatalf("invalid -list-format %q, want lines or json", *listFormat)
+	}
+	if *hashFormat != "dir" && *hashFormat != "json" {
+		log.Fatalf("invalid -hash-format %q, want dir or json", *hashFormat)
+	}
+	if *listPush != "left" && *listPush != "right" {
+		log.Fatalf("invalid -list-push %q, want left or right", *listPush)
+	}
+	switch *streamFormat {
+	case "json", "json-pretty", "ndjson":
+	default:
+		log.Fatalf("invalid -stream-format %q, want json, json-pretty or ndjson", *streamFormat)
+	}
+	mode, err := strconv.ParseUint(*fileMode, 8, 32)
+	if err != nil || mode&^0777 != 0 {
+		log.Fatalf("invalid -file-mode %q, want octal permission bits like 0644", *fileMode)
+	}
+	dmode, err := strconv.ParseUint(*dirMode, 8, 32)
+	if err != nil || dmode&^0777 != 0 {
+		log.Fatalf("invalid -dir-mode %q, want octal permission bits like 0755", *dirMode)
+	}
+
+	if *debug {
+		fuse.Debug = func(msg interface{}) { slog.Debug(fmt.Sprint(msg), "op", "fuse") }
+	}
+
+	options := []fuse.MountOption{
 		fuse.FSName("rsfs"),
 		fuse.Subtype("streamfs"),
 		fuse.LocalVolume(),
 		fuse.VolumeName("Redis Streams"),
-	)
+	}
+	if *readOnly {
+		options = append(options, fuse.ReadOnly())
+	}
+	if *allowOther {
+		options = append(options, fuse.AllowOther())
+	}
+
+	mounted := make(chan struct{})
+	if *mountTimeout > 0 {
+		go mountWatchdog(mountpoint, *mountTimeout, mounted)
+	}
+	c, err := fuse.Mount(mountpoint, options...)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer c.Close()
+	go func() {
+		<-c.Ready
+		close(mounted)
+	}()
 
-	rClient, err := newRedisClient([]string{"127.0.0.1:6379"})
+	if (len(redisSentinels) > 0) != (*redisMasterName != "") {
+		log.Fatal("-redis-sentinel and -redis-master-name must be used together")
+	}
+	if len(redisSentinels) > 0 {
+		if *redisCluster {
+			log.Fatal("-redis-sentinel cannot be used with -redis-cluster")
+		}
+		// the failover client discovers the master through the sentinels
+		redisAddrs = redisSentinels
+	}
+
+	if *redisSocket != "" {
+		if len(redisSentinels) > 0 || *redisCluster {
+			log.Fatal("-redis-socket cannot be used with sentinel or cluster mode")
+		}
+		redisAddrs = stringList{*redisSocket}
+	}
+
+	if len(redisAddrs) == 0 {
+		redisAddrs = stringList{"127.0.0.1:6379"}
+	}
+
+	if *redisReadReplica && *redisMasterName == "" && len(redisAddrs) < 2 && !*redisCluster {
+		log.Fatal("-read-from-replica needs cluster or sentinel mode")
+	}
+
+	if ((*redisMasterName == "" && len(redisAddrs) > 1) || *redisCluster) && *redisDB != 0 {
+		log.Fatal("-redis-db cannot be used with multiple cluster endpoints")
+	}
+
+	opts := &redis.UniversalOptions{
+		Addrs:           redisAddrs,
+		DB:              *redisDB,
+		Username:        *redisUser,
+		Password:        *redisPass,
+		RouteByLatency:  *redisRouteByLatency,
+		RouteRandomly:   *redisRouteRandomly,
+		ReadOnly:        *redisReadReplica,
+		MasterName:      *redisMasterName,
+		PoolSize:        *redisPoolSize,
+		MinIdleConns:    *redisMinIdle,
+		DialTimeout:     *redisDialTimeout,
+		ReadTimeout:     *redisReadTimeout,
+		WriteTimeout:    *redisWriteTimeout,
+		MaxRetries:      *redisRetries,
+		MaxRetryBackoff: *redisMaxRetryBackoff,
+		// FUSE request deadlines bound socket reads and writes too
+		ContextTimeoutEnabled: true,
+	}
+	if opts.MaxRetries == 0 {
+		// go-redis reads 0 as its default of 3 retries
+		opts.MaxRetries = -1
+	}
+	if *redisSocket != "" {
+		opts.Dialer = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", addr)
+		}
+	}
+	if opts.Password == "" {
+		opts.Password = os.Getenv("REDIS_PASSWORD")
+	}
+
+	if *redisTLS || *redisCA != "" || *redisCert != "" || *redisTLSSkipVerify {
+		opts.TLSConfig, err = newTLSConfig(*redisCA, *redisCert, *redisKey, *redisTLSSkipVerify)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	rClient, err := newRedisClient(opts, *redisCluster)
 	if err != nil {
-		log.Fatal("failed to connect to redis: %s", err.Error())
+		log.Fatalf("failed to connect to redis: %v", err)
 	}
 
-	go server()
+	defer rClient.Close()
+	rClient.AddHook(metricsHook{})
 
-	err = fs.Serve(c, &redisFS{
+	if *otelEndpoint != "" {
+		shutdown, err := setupTracing(*otelEndpoint)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer shutdown(context.Background())
+		rClient.AddHook(tracingHook{})
+	}
+
+	go unmountOnSignal(mountpoint)
+	rfs := &redisFS{
 		client:       rClient,
-		attrValidity: 1 * time.Second,
-	})
+		attrValidity: *attrValidity,
+		scanCount:    *scanCount,
+		readOnly:     *readOnly,
+		db:           *redisDB,
+		defaultTTL:   *defaultTTL,
+		types:        newTypeCache(*attrValidity),
+		contents:     newContentCache(*readCacheSize, *attrValidity),
+		missing:      newNegativeCache(*negativeTTL),
+		escapeKeys:   *escapeKeys,
+		prefix:       *prefix,
+		listFormat:   *listFormat,
+		streamFormat: *streamFormat,
+		streamMaxLen: *streamMaxLen,
+		streamApprox: *streamMaxApprox,
+		tailBlock:    *tailBlock,
+		skipErrors:   *skipErrors,
+		typeSuffix:   *typeSuffix,
+		fileMode:     os.FileMode(mode),
+		dirMode:      os.FileMode(dmode),
+		persistMeta:  *persistMetadata,
+		noCommit:     *noCommit,
+		maxWriteBuf:  *maxWriteBuffer,
+		writeThrough: *writeThrough,
+		coalesce:     *writeCoalesce,
+		noClobber:    *noClobber,
+		popOnRead:    *popOnRead,
+		listPush:     *listPush,
+		listAsDir:    *listAsDir,
+		separator:    *separator,
+		rejson:       *enableRejson,
+		pubsub:       *enablePubsub,
+		compute:      *compute,
+		optimistic:   *optimistic,
+		rootKey:      *rootKey,
+		touchTTL:     *touchTTL,
+		include:      include,
+		hashFormat:   *hashFormat,
+		dumpFiles:    *dumpFiles,
+		expiresFiles: *expiresFiles,
+		exclude:      exclude,
+		readonlyKeys: readonlyKeys,
+		safeDelete:   *safeDelete,
+	}
+
+	if *watchKeyspace {
+		go rfs.watchKeyspace()
+	}
+
+	go server(*metricsAddr, *controlToken, rfs)
+
+	err = fs.Serve(c, rfs)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -67,11 +368,85 @@ func main() {
 	}
 }
 
-func server() {
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		fileName = r.URL.Path[1:]
-		w.WriteHeader(http.StatusOK)
-	})
+// unmountOnSignal unmounts on SIGINT/SIGTERM, which makes fs.Serve return so
+// main can release the redis client and exit through its normal path.
+func unmountOnSignal(mountpoint string) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	for sig := range sigs {
+		slog.Info("unmounting", "signal", sig, "mountpoint", mountpoint)
+		if err := fuse.Unmount(mountpoint); err != nil {
+			// typically busy, let the user retry
+			slog.Error("unmount failed", "mountpoint", mountpoint, "err", err)
+			continue
+		}
+		return
+	}
+}
+
+// mountWatchdog exits the process if mounted is not closed within timeout, so
+// a hung fusermount or kernel fails init scripts instead of blocking them.
+func mountWatchdog(mountpoint string, timeout time.Duration, mounted <-chan struct{}) {
+	select {
+	case <-mounted:
+	case <-time.After(timeout):
+		slog.Error("mount timed out", "mountpoint", mountpoint, "timeout", timeout)
+		// the mount may be half done, or not there at all
+		fuse.Unmount(mountpoint)
+		os.Exit(1)
+	}
+}
+
+func newLogger(level, format string, debug bool) (*slog.Logger, error) {
+
+	opts := &slog.HandlerOptions{}
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid -log-level %q, want debug, info, warn or error", level)
+	}
+	if debug {
+		l = slog.LevelDebug
+	}
+	opts.Level = l
+
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid -log-format %q, want text or json", format)
+	}
+}
+
+func newTLSConfig(caFile, certFile, keyFile string, skipVerify bool) (*tls.Config, error) {
+
+	cfg := &tls.Config{}
+
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if skipVerify {
+		slog.Warn("redis TLS certificate verification is disabled, connection is insecure")
+		cfg.InsecureSkipVerify = true
+	}
 
-	log.Fatal(http.ListenAndServe(":8888", nil))
+	return cfg, nil
 }
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"bazil.org/fuse"
+	"github.com/redis/go-redis/v9"
+)
+
+// metaPrefix names the hashes holding the mode, uid and gid set on keys
+// with -persist-metadata. They are hidden from listings.
+const metaPrefix = "__rsfs_meta__:"
+
+func metaKey(key string) string {
+	return metaPrefix + key
+}
+
+func isMetaKey(key string) bool {
+	return strings.HasPrefix(key, metaPrefix)
+}
+
+// loadMeta refreshes f.meta, the caller holds f.mu.
+func (f *redisFile) loadMeta(ctx context.Context) error {
+	if !f.persistMeta || f.pt != "" || f.noCommit {
+		return nil
+	}
+
+	meta, err := f.client.HGetAll(ctx, metaKey(f.name)).Result()
+	if err != nil && err != redis.Nil {
+		slog.Error("redis command failed", "op", "Attr:HGetAll", "key", f.name, "err", err)
+		return errno(err)
+	}
+	f.meta = meta
+	return nil
+}
+
+// saveMeta stores the mode and ownership changes of req, unless with
+// -no-commit. Nothing is enforced, the values are only reported back by
+// Attr.
+func (f *redisFile) saveMeta(ctx context.Context, req *fuse.SetattrRequest) error {
+	if !f.persistMeta || f.pt != "" {
+		return nil
+	}
+
+	var values []interface{}
+	if req.Valid.Mode() {
+		values = append(values, "mode", strconv.FormatUint(uint64(req.Mode.Perm()), 8))
+	}
+	if req.Valid.Uid() {
+		values = append(values, "uid", strconv.FormatUint(uint64(req.Uid), 10))
+	}
+	if req.Valid.Gid() {
+		values = append(values, "gid", strconv.FormatUint(uint64(req.Gid), 10))
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	if _, err := f.client.HMSet(ctx, metaKey(f.name), values...).Result(); err != nil {
+		slog.Error("redis command failed", "op", "Setattr:HMSet", "key", f.name, "err", err)
+		return errno(err)
+	}
+
+	f.mu.Lock()
+	if f.meta == nil {
+		f.meta = make(map[string]string)
+	}
+	for i := 0; i < len(values); i += 2 {
+		f.meta[values[i].(string)] = values[i+1].(string)
+	}
+	f.mu.Unlock()
+	return nil
+}
+
+// applyMeta overrides a with the stored metadata, the caller holds f.mu.
+func (f *redisFile) applyMeta(a *fuse.Attr) {
+	if v, err := strconv.ParseUint(f.meta["mode"], 8, 32); err == nil {
+		a.Mode = os.FileMode(v).Perm()
+	}
+	if v, err := strconv.ParseUint(f.meta["uid"], 10, 32); err == nil {
+		a.Uid = uint32(v)
+	}
+	if v, err := strconv.ParseUint(f.meta["gid"], 10, 32); err == nil {
+		a.Gid = uint32(v)
+	}
+}
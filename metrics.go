@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	fuseOps = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rsfs_fuse_ops_total",
+		Help: "FUSE operations served, by operation.",
+	}, []string{"op"})
+
+	fuseErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rsfs_fuse_errors_total",
+		Help: "FUSE operations that returned an error, by operation.",
+	}, []string{"op"})
+
+	redisDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rsfs_redis_command_duration_seconds",
+		Help:    "Latency of redis commands and pipelines.",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+	}, []string{"command"})
+
+	redisErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rsfs_redis_errors_total",
+		Help: "Redis commands that failed, excluding nil replies.",
+	}, []string{"command"})
+
+	writeRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rsfs_streamed_writes_total",
+		Help: "Writes past -write-through-size, by whether they were merged into a pending SETRANGE or started one.",
+	}, []string{"result"})
+
+	cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rsfs_cache_requests_total",
+		Help: "Cache lookups, by cache and hit or miss.",
+	}, []string{"cache", "result"})
+)
+
+// observeOp counts a FUSE operation and, if *err is set when the operation
+// returns, its failure. Use it as defer observeOp("op", &err).
+func observeOp(op string, err *error) {
+	fuseOps.WithLabelValues(op).Inc()
+	if *err != nil {
+		fuseErrors.WithLabelValues(op).Inc()
+	}
+}
+
+func observeCache(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheRequests.WithLabelValues(cache, result).Inc()
+}
+
+// metricsHook times every redis command and pipeline issued by the client.
+type metricsHook struct{}
+
+func (metricsHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (metricsHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		observeRedis(start, cmd.Name(), cmd.Err())
+		return err
+	}
+}
+
+func (metricsHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+		var failed error
+		for _, cmd := range cmds {
+			if cmd.Err() != nil && cmd.Err() != redis.Nil {
+				failed = cmd.Err()
+				break
+			}
+		}
+		observeRedis(start, "pipeline", failed)
+		return err
+	}
+}
+
+func observeRedis(start time.Time, command string, err error) {
+	redisDuration.WithLabelValues(command).Observe(time.Since(start).Seconds())
+	if err != nil && err != redis.Nil {
+		redisErrors.WithLabelValues(command).Inc()
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+// fileID identifies the value behind a redisFile: a key, or a field or
+// entry of the hash or stream parent.
+type fileID struct {
+	pt, parent, name string
+}
+
+func (f *redisFile) ident() fileID {
+	return fileID{f.pt, f.parent, f.name}
+}
+
+// file returns the live node for the value f stands for, registering f if
+// there is none, so every lookup of a key shares one node and the write
+// buffers of its open handles.
+func (rfs *redisFS) file(f *redisFile) *redisFile {
+
+	rfs.nodeMu.Lock()
+	defer rfs.nodeMu.Unlock()
+
+	if rfs.files == nil {
+		rfs.files = make(map[fileID]*redisFile)
+	}
+	cur, ok := rfs.files[f.ident()]
+	if !ok {
+		rfs.files[f.ident()] = f
+		return f
+	}
+
+	cur.mu.Lock()
+	if f.t != "" && len(cur.handles) == 0 {
+		// the key may have been replaced by one of another type
+		cur.t = f.t
+	}
+	cur.mu.Unlock()
+	return cur
+}
+
+// unlink detaches the node of a removed or replaced value, so a file later
+// created under its name gets a new node like it would on disk.
+func (rfs *redisFS) unlink(id fileID) {
+	rfs.nodeMu.Lock()
+	delete(rfs.files, id)
+	rfs.nodeMu.Unlock()
+}
+
+// Forget drops f once the kernel holds no more references to it. A lookup
+// racing with this may still hand out f, a later one then gets a new node,
+// which is no worse than before nodes were shared.
+func (f *redisFile) Forget() {
+	f.nodeMu.Lock()
+	if f.files[f.ident()] == f {
+		delete(f.files, f.ident())
+	}
+	f.nodeMu.Unlock()
+
+	if f.pt == "" {
+		f.invalidate(f.name)
+	}
+}
+
+// Forget releases what is cached about the key behind a hash or stream
+// directory.
+func (d *redisDir) Forget() {
+	if d.name != "" {
+		d.invalidate(d.name)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestForget(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	mr.Set("s", "v")
+	mr.RPush("l", "a", "b")
+	mr.HSet("h", "f", "v")
+	root := rootDir(t, rfs)
+
+	var files []*redisFile
+	for _, name := range []string{"s", "l"} {
+		f := lookupFile(t, root, name)
+		readFile(t, f)
+		files = append(files, f)
+	}
+	h := lookup(t, root, "h").(*redisDir)
+	files = append(files, lookupFile(t, h, "f"))
+
+	if len(rfs.files) != 3 || len(rfs.types.entries) != 3 || len(rfs.contents.items) != 1 {
+		t.Fatalf("before Forget: %d files, %d types, %d contents",
+			len(rfs.files), len(rfs.types.entries), len(rfs.contents.items))
+	}
+
+	for _, f := range files {
+		f.Forget()
+	}
+	h.Forget()
+
+	if len(rfs.files) != 0 || len(rfs.types.entries) != 0 || len(rfs.contents.items) != 0 {
+		t.Fatalf("after Forget: %d files, %d types, %d contents",
+			len(rfs.files), len(rfs.types.entries), len(rfs.contents.items))
+	}
+}
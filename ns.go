@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"syscall"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/redis/go-redis/v9"
+)
+
+// keyspace reports whether d lists Redis keys, which is the root and, with
+// -separator, every namespace directory below it.
+func (d *redisDir) keyspace() bool {
+	return d.root || d.ns != ""
+}
+
+// splitNamespaces separates scanned keys into the keys directly inside d and
+// the namespace directories holding the rest, as dirents. A key named like
+// a namespace, app:user next to app:user:1, keeps the name and the
+// namespace is listed with the separator appended, as user:.
+func (d *redisDir) splitNamespaces(keys []string) ([]string, []fuse.Dirent) {
+
+	if d.separator == "" {
+		return keys, nil
+	}
+
+	var leaves, segs []string
+	isLeaf := make(map[string]bool)
+	isSeg := make(map[string]bool)
+	for _, k := range keys {
+		if !d.visible(k) {
+			continue
+		}
+		rest := strings.TrimPrefix(k, d.prefix+d.ns)
+		i := strings.Index(rest, d.separator)
+		if i < 0 {
+			leaves = append(leaves, k)
+			isLeaf[rest] = true
+			continue
+		}
+		if !isSeg[rest[:i]] {
+			isSeg[rest[:i]] = true
+			segs = append(segs, rest[:i])
+		}
+	}
+
+	var dirs []fuse.Dirent
+	for _, seg := range segs {
+		name := seg
+		if isLeaf[seg] {
+			name += d.separator
+		}
+		dirs = append(dirs, fuse.Dirent{Name: d.displayName(name), Type: fuse.DT_Dir})
+	}
+	return leaves, dirs
+}
+
+// lookupNamespace returns the namespace directory for key if any key lives
+// below it, key may end in the separator as namespaces shadowed by a key
+// are listed. Unlike listings this may SCAN the whole keyspace for a miss.
+func (d *redisDir) lookupNamespace(ctx context.Context, key string) (fs.Node, error) {
+
+	if d.separator == "" {
+		return nil, syscall.ENOENT
+	}
+
+	ns := strings.TrimSuffix(key, d.separator) + d.separator
+	ok, err := d.anyKey(ctx, globEscape(ns)+"*")
+	if err != nil {
+		return nil, errno(err)
+	}
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+
+	return &redisDir{
+		ns:      strings.TrimPrefix(ns, d.prefix),
+		redisFS: d.redisFS,
+	}, nil
+}
+
+// anyKey reports whether SCAN finds at least one key matching match.
+func (rfs *redisFS) anyKey(ctx context.Context, match string) (bool, error) {
+
+	cc, ok := rfs.client.(*redis.ClusterClient)
+	if !ok {
+		return anyNodeKey(ctx, rfs.client, match, rfs.scanCount)
+	}
+
+	var found bool
+	var mu sync.Mutex
+	err := cc.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		ok, err := anyNodeKey(ctx, node, match, rfs.scanCount)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		found = found || ok
+		mu.Unlock()
+		return nil
+	})
+	return found, err
+}
+
+func anyNodeKey(ctx context.Context, c redis.Cmdable, match string, count int64) (bool, error) {
+
+	var cursor uint64
+	for {
+		batch, next, err := c.Scan(ctx, cursor, match, count).Result()
+		if err != nil {
+			return false, err
+		}
+		if len(batch) > 0 {
+			return true, nil
+		}
+		cursor = next
+		if cursor == 0 {
+			return false, nil
+		}
+	}
+}
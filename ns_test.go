@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"testing"
+)
+
+func dirNames(t *testing.T, d *redisDir) []string {
+	t.Helper()
+	entries, err := d.ReadDirAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestNamespaceMixedLevels(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	rfs.separator = ":"
+	for k, v := range map[string]string{
+		"app:user":   "leaf",
+		"app:user:1": "one",
+		"app:user:2": "two",
+		"app:cfg":    "cfg",
+		"app:x:y":    "y",
+	} {
+		mr.Set(k, v)
+	}
+
+	app := lookup(t, rootDir(t, rfs), "app").(*redisDir)
+	if got, want := dirNames(t, app), []string{"cfg", "user", "user:", "x"}; !slices.Equal(got, want) {
+		t.Fatalf("app/ = %q, want %q", got, want)
+	}
+
+	if got := readFile(t, lookupFile(t, app, "user")); got != "leaf" {
+		t.Fatalf("app/user = %q", got)
+	}
+	if got := readFile(t, lookupFile(t, app, "cfg")); got != "cfg" {
+		t.Fatalf("app/cfg = %q", got)
+	}
+
+	user := lookup(t, app, "user:").(*redisDir)
+	if got, want := dirNames(t, user), []string{"1", "2"}; !slices.Equal(got, want) {
+		t.Fatalf("app/user:/ = %q, want %q", got, want)
+	}
+	if got := readFile(t, lookupFile(t, user, "2")); got != "two" {
+		t.Fatalf("app/user:/2 = %q", got)
+	}
+
+	x := lookup(t, app, "x").(*redisDir)
+	if got := readFile(t, lookupFile(t, x, "y")); got != "y" {
+		t.Fatalf("app/x/y = %q", got)
+	}
+}
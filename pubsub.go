@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"syscall"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/redis/go-redis/v9"
+)
+
+// channelsDirName is the synthetic root directory bridging pub/sub channels
+// with -enable-pubsub.
+const channelsDirName = "__channels__"
+
+// channelsDir lists the channels with subscribers and resolves any name to
+// a channel file, as channels need not exist before use.
+type channelsDir struct {
+	*redisFS
+}
+
+func (c *channelsDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Valid = c.attrValidity
+	a.Mode = os.ModeDir | 0555
+	return nil
+}
+
+func (c *channelsDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	return &channelFile{channel: name, redisFS: c.redisFS}, nil
+}
+
+func (c *channelsDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+
+	channels, err := c.client.PubSubChannels(ctx, "*").Result()
+	if err != nil {
+		slog.Error("redis command failed", "op", "ReadDirAll:PubSubChannels", "err", err)
+		return nil, errno(err)
+	}
+	sort.Strings(channels)
+
+	entries := make([]fuse.Dirent, len(channels))
+	for i := range channels {
+		entries[i].Name = channels[i]
+		entries[i].Type = fuse.DT_File
+	}
+	return entries, nil
+}
+
+// channelFile subscribes when opened for reading and reads as the messages
+// published from then on, one per line, until the reader closes it. Each
+// line written to it is published as one message.
+type channelFile struct {
+	channel string
+	*redisFS
+}
+
+func (c *channelFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Valid = c.attrValidity
+	a.Mode = 0666
+	if c.readOnly {
+		a.Mode = 0444
+	}
+	return nil
+}
+
+func (c *channelFile) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	// allow O_TRUNC and shell redirection, there is nothing to truncate
+	return nil
+}
+
+func (c *channelFile) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	if !req.Flags.IsReadOnly() && c.readOnly {
+		return nil, syscall.EROFS
+	}
+
+	h := &channelHandle{c: c}
+	if !req.Flags.IsWriteOnly() {
+		h.ps = c.client.Subscribe(ctx, c.channel)
+		// wait for the confirmation so messages published after open
+		// are not missed
+		if _, err := h.ps.Receive(ctx); err != nil {
+			h.ps.Close()
+			slog.Error("redis command failed", "op", "Open:Subscribe", "channel", c.channel, "err", err)
+			return nil, errno(err)
+		}
+	}
+
+	resp.Flags |= fuse.OpenDirectIO | fuse.OpenNonSeekable
+	return h, nil
+}
+
+type channelHandle struct {
+	c  *channelFile
+	ps *redis.PubSub
+
+	mu sync.Mutex
+	rb []byte
+	wb []byte
+}
+
+func (h *channelHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) (err error) {
+	defer observeOp("subscribe", &err)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.ps == nil {
+		return syscall.EBADF
+	}
+
+	if len(h.rb) == 0 {
+		select {
+		case <-ctx.Done():
+			return fuse.EINTR
+		case msg, ok := <-h.ps.Channel():
+			if !ok {
+				return nil
+			}
+			h.rb = append(h.rb, msg.Payload...)
+			h.rb = append(h.rb, '\n')
+		}
+	}
+
+	n := req.Size
+	if n > len(h.rb) {
+		n = len(h.rb)
+	}
+	resp.Data = append(resp.Data[:0], h.rb[:n]...)
+	h.rb = h.rb[n:]
+	return nil
+}
+
+// Write publishes every complete line as it arrives, a trailing partial
+// line waits for more data or Flush.
+func (h *channelHandle) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.wb = append(h.wb, req.Data...)
+	i := bytes.LastIndexByte(h.wb, '\n')
+	if i < 0 {
+		resp.Size = len(req.Data)
+		return nil
+	}
+
+	lines := h.wb[:i]
+	h.wb = append([]byte(nil), h.wb[i+1:]...)
+	if err := h.publish(ctx, bytes.Split(lines, []byte{'\n'})); err != nil {
+		return err
+	}
+	resp.Size = len(req.Data)
+	return nil
+}
+
+func (h *channelHandle) Flush(ctx context.Context, req *fuse.FlushRequest) error {
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.wb) == 0 {
+		return nil
+	}
+	msg := h.wb
+	h.wb = nil
+	return h.publish(ctx, [][]byte{msg})
+}
+
+func (h *channelHandle) publish(ctx context.Context, msgs [][]byte) (err error) {
+	defer observeOp("publish", &err)
+
+	_, err = h.c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, m := range msgs {
+			pipe.Publish(ctx, h.c.channel, m)
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("redis command failed", "op", "Write:Publish", "channel", h.c.channel, "err", err)
+		return errno(err)
+	}
+	return nil
+}
+
+func (h *channelHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	if h.ps != nil {
+		h.ps.Close()
+	}
+	return nil
+}
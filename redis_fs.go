@@ -1,56 +1,357 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"hash/fnv"
+	"log/slog"
+	"maps"
+	"math"
+	"net/url"
 	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
-	redis "github.com/go-redis/redis/v7"
+	"bazil.org/fuse/fuseutil"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-func newRedisClient(endpoints []string) (redis.UniversalClient, error) {
+// newRedisClient connects using opts. NewUniversalClient only picks cluster
+// mode for multiple addresses, so cluster forces it for a single seed node.
+func newRedisClient(opts *redis.UniversalOptions, cluster bool) (redis.UniversalClient, error) {
 
-	client := redis.NewUniversalClient(&redis.UniversalOptions{
-		Addrs: endpoints,
-	})
+	opts.IsClusterMode = cluster
+	if opts.MasterName != "" && opts.ReadOnly {
+		// the plain failover client would send writes to replicas too, its
+		// cluster flavour routes by command like a cluster client does
+		opts.IsClusterMode = true
+	}
+	client := redis.NewUniversalClient(opts)
 
-	if _, err := client.Ping().Result(); err != nil {
-		return nil, err
+	if _, err := client.Ping(context.Background()).Result(); err != nil {
+		client.Close()
+		if isAuthError(err) {
+			return nil, fmt.Errorf("redis rejected the supplied credentials: %w", err)
+		}
+		return nil, fmt.Errorf("no reachable redis endpoint in %s: %w", strings.Join(opts.Addrs, ","), err)
 	}
 
 	return client, nil
 }
 
+func isAuthError(err error) bool {
+	msg := err.Error()
+	return strings.HasPrefix(msg, "NOAUTH") ||
+		strings.HasPrefix(msg, "WRONGPASS") ||
+		strings.HasPrefix(msg, "ERR invalid password") ||
+		strings.HasPrefix(msg, "ERR invalid username-password pair")
+}
+
 type redisFS struct {
 	client       redis.UniversalClient
 	attrValidity time.Duration
+	scanCount    int64
+	readOnly     bool
+	db           int
+	defaultTTL   time.Duration
+	types        *typeCache
+	contents     *contentCache
+	missing      *negativeCache
+	escapeKeys   bool
+	prefix       string
+	listFormat   string
+	streamFormat string
+	streamMaxLen int64
+	streamApprox bool
+	tailBlock    time.Duration
+	skipErrors   bool
+	typeSuffix   bool
+	fileMode     os.FileMode
+	dirMode      os.FileMode
+	persistMeta  bool
+	noCommit     bool
+	maxWriteBuf  int64
+	popOnRead    bool
+	listPush     string
+	separator    string
+	rejson       bool
+	optimistic   bool
+	rootKey      string
+	touchTTL     time.Duration
+	include      []string
+	hashFormat   string
+	dumpFiles    bool
+	expiresFiles bool
+	exclude      []string
+	writeThrough int64
+	coalesce     time.Duration
+	noClobber    bool
+	pubsub       bool
+	compute      bool
+	readonlyKeys []string
+	listAsDir    bool
+	safeDelete   bool
+
+	selMu    sync.Mutex
+	selected string
+
+	nodeMu sync.Mutex
+	files  map[fileID]*redisFile
+
+	infoMu sync.Mutex
+	infos  map[string]cachedInfo
+}
+
+// currentName is the root entry standing for the key picked with /select.
+const currentName = "current"
+
+// selectKey makes key the target of the current entry, "" removes it.
+func (rfs *redisFS) selectKey(key string) {
+	rfs.selMu.Lock()
+	rfs.selected = key
+	rfs.selMu.Unlock()
+}
+
+func (rfs *redisFS) selection() string {
+	rfs.selMu.Lock()
+	defer rfs.selMu.Unlock()
+	return rfs.selected
 }
 
 func (rfs *redisFS) Root() (fs.Node, error) {
-	return &redisDir{
-		root:    true,
+
+	if rfs.rootKey == "" {
+		return &redisDir{
+			root:    true,
+			redisFS: rfs,
+		}, nil
+	}
+
+	// -key mounts a single key, files need a file as mountpoint
+	t, err := rfs.keyType(context.Background(), rfs.rootKey)
+	if err != nil {
+		return nil, errno(err)
+	}
+	if t == "none" {
+		return nil, syscall.ENOENT
+	}
+	if rfs.isDir(t) {
+		return &redisDir{
+			name:    rfs.rootKey,
+			t:       t,
+			redisFS: rfs,
+		}, nil
+	}
+	return &redisFile{
+		name:    rfs.rootKey,
+		t:       t,
 		redisFS: rfs,
 	}, nil
 }
 
+// scanKeys walks the keyspace with SCAN instead of blocking Redis with KEYS.
+// A cluster client only scans one node, so every master is walked instead.
+func (rfs *redisFS) scanKeys(ctx context.Context, match string) ([]string, error) {
+
+	cc, ok := rfs.client.(*redis.ClusterClient)
+	if !ok {
+		return scanNode(ctx, rfs.client, match, rfs.scanCount)
+	}
+
+	var keys []string
+	var mu sync.Mutex
+	err := cc.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		nodeKeys, err := scanNode(ctx, node, match, rfs.scanCount)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		keys = append(keys, nodeKeys...)
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// masters are scanned concurrently, keep the merged listing stable
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+func scanNode(ctx context.Context, c redis.Cmdable, match string, count int64) ([]string, error) {
+
+	var keys []string
+	seen := make(map[string]struct{})
+
+	var cursor uint64
+	for {
+		// SCAN may return the same key more than once
+		batch, next, err := c.Scan(ctx, cursor, match, count).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range batch {
+			if _, ok := seen[k]; ok {
+				continue
+			}
+			seen[k] = struct{}{}
+			keys = append(keys, k)
+		}
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+
+	return keys, nil
+}
+
+// keyType returns the Redis type of key, consulting the type cache first.
+// Missing keys report "none".
+func (rfs *redisFS) keyType(ctx context.Context, key string) (string, error) {
+	if t, ok := rfs.types.get(key); ok {
+		return t, nil
+	}
+
+	t, err := rfs.client.Type(ctx, key).Result()
+	if err != nil {
+		return "", err
+	}
+
+	rfs.types.set(key, t)
+	return t, nil
+}
+
+// invalidate drops everything cached about key, after rsfs writes it or an
+// external writer notifies rsfs of a change.
+func (rfs *redisFS) invalidate(key string) {
+	rfs.types.invalidate(key)
+	rfs.contents.invalidate(key)
+	rfs.missing.invalidate(key)
+}
+
+func (rfs *redisFS) invalidateAll() {
+	rfs.types.clear()
+	rfs.contents.clear()
+	rfs.missing.clear()
+}
+
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+// globEscape quotes s so it matches literally in a SCAN MATCH pattern.
+func globEscape(s string) string {
+	return globEscaper.Replace(s)
+}
+
+// keyEscaper percent-encodes the bytes a Redis key may hold but a FUSE
+// name may not, plus '%' itself so the mapping round-trips.
+var keyEscaper = strings.NewReplacer("%", "%25", "/", "%2F", "\x00", "%00", "\n", "%0A")
+
+// displayName maps a Redis key or field to the name shown in listings.
+func (rfs *redisFS) displayName(key string) string {
+	if !rfs.escapeKeys {
+		return key
+	}
+	return keyEscaper.Replace(key)
+}
+
+// keyName reverses displayName for names coming from the kernel.
+func (rfs *redisFS) keyName(name string) string {
+	if !rfs.escapeKeys {
+		return name
+	}
+	key, err := url.PathUnescape(name)
+	if err != nil {
+		// not something displayName produced, use it verbatim
+		return name
+	}
+	return key
+}
+
 func (rfs *redisFS) GenerateInode(parentInode uint64, name string) uint64 {
 	h := fnv.New64a()
 	b := make([]byte, binary.MaxVarintLen64)
 	binary.LittleEndian.PutUint64(b, parentInode)
+	h.Write(b)
 	h.Write([]byte(name))
 	return h.Sum64()
 }
 
+const statfsBlockSize = 4096
+
+// Statfs reports DBSIZE as the file count and used_memory against maxmemory
+// as used and total bytes. An unbounded maxmemory falls back to the host's
+// total memory.
+func (rfs *redisFS) Statfs(ctx context.Context, req *fuse.StatfsRequest, resp *fuse.StatfsResponse) error {
+
+	n, err := rfs.client.DBSize(ctx).Result()
+	if err != nil {
+		return errno(err)
+	}
+
+	info, err := rfs.client.Info(ctx, "memory").Result()
+	if err != nil {
+		return errno(err)
+	}
+	mem := parseInfo(info)
+
+	used, _ := strconv.ParseUint(mem["used_memory"], 10, 64)
+	total, _ := strconv.ParseUint(mem["maxmemory"], 10, 64)
+	if total == 0 {
+		total, _ = strconv.ParseUint(mem["total_system_memory"], 10, 64)
+	}
+	if total < used {
+		total = used
+	}
+
+	resp.Bsize = statfsBlockSize
+	resp.Frsize = statfsBlockSize
+	resp.Blocks = total / statfsBlockSize
+	resp.Bfree = (total - used) / statfsBlockSize
+	resp.Bavail = resp.Bfree
+	// keys are not a limited resource, never report the inode table full
+	resp.Ffree = math.MaxUint32
+	resp.Files = uint64(n) + resp.Ffree
+	resp.Namelen = 255
+
+	return nil
+}
+
+// parseInfo splits INFO output into its key:value fields.
+func parseInfo(info string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if i := strings.IndexByte(line, ':'); i > 0 {
+			fields[line[:i]] = line[i+1:]
+		}
+	}
+	return fields
+}
+
 type redisDir struct {
 	root    bool
+	ns      string
 	name    string
 	t       string
 	entries []fuse.Dirent
@@ -58,242 +359,1898 @@ type redisDir struct {
 	*redisFS
 }
 
+// childKey maps a name inside d to the Redis key or field it stands for.
+// Root and namespace entries live under the mount prefix and namespace.
+func (d *redisDir) childKey(ctx context.Context, name string) string {
+	if !d.keyspace() {
+		return d.keyName(name)
+	}
+
+	key := d.prefix + d.ns + d.keyName(name)
+	if d.typeSuffix {
+		for _, t := range suffixTypes {
+			base := strings.TrimSuffix(key, "."+t)
+			if base == key {
+				continue
+			}
+			// a key really named "x.list" keeps winning over list "x"
+			if bt, err := d.keyType(ctx, base); err == nil && bt == t {
+				return base
+			}
+		}
+	}
+	if base := strings.TrimSuffix(key, ".json"); base != key && (d.rejson || d.hashFormat == "json") {
+		if bt, err := d.keyType(ctx, base); err == nil && d.jsonFile(bt) {
+			return base
+		}
+	}
+	return key
+}
+
+// jsonFile reports whether keys of type t are shown as <key>.json files.
+func (rfs *redisFS) jsonFile(t string) bool {
+	return (rfs.rejson && t == rejsonType) || (rfs.hashFormat == "json" && t == "hash")
+}
+
+// isDir reports whether keys of type t are shown as directories.
+func (rfs *redisFS) isDir(t string) bool {
+	return t == "stream" || (t == "hash" && rfs.hashFormat != "json") || (t == "list" && rfs.listAsDir)
+}
+
+// suffixTypes are the file-backed types named with a ".<type>" suffix at
+// the root when -type-suffix is set. Strings stay bare and hashes and
+// streams are already told apart as directories.
+var suffixTypes = []string{"list", "set", "zset"}
+
+// childName reverses childKey for listings, t is the key's type if known.
+func (d *redisDir) childName(key, t string) string {
+	if !d.keyspace() {
+		return d.displayName(key)
+	}
+
+	return d.displayName(strings.TrimPrefix(key, d.prefix+d.ns)) + d.nameSuffix(t)
+}
+
+// nameSuffix is what childName appends to the names of keys of type t.
+func (d *redisDir) nameSuffix(t string) string {
+	if d.typeSuffix && slices.Contains(suffixTypes, t) {
+		return "." + t
+	}
+	if d.jsonFile(t) {
+		return ".json"
+	}
+	return ""
+}
+
+// dirAttrMode is the mode of directories, -dir-mode without write bits on
+// a read-only mount.
+func (rfs *redisFS) dirAttrMode() os.FileMode {
+	mode := os.ModeDir | rfs.dirMode
+	if rfs.readOnly {
+		mode &^= 0222
+	}
+	return mode
+}
+
 func (d *redisDir) Attr(ctx context.Context, a *fuse.Attr) error {
 	a.Valid = d.attrValidity
-	a.Mode = os.ModeDir | 0555
+	a.Mode = d.dirAttrMode()
 	if d.root == true {
 		a.Inode = 1
 	}
 	return nil
 }
 
-func (d *redisDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+func (d *redisDir) Lookup(ctx context.Context, name string) (_ fs.Node, err error) {
+	defer observeOp("lookup", &err)
+	ctx, span := startSpan(ctx, "Lookup", d.name+d.ns+name)
+	defer func() { endSpan(span, err) }()
+
+	if d.root {
+		if sf, ok := d.synthFiles()[name]; ok {
+			return sf, nil
+		}
+		if name == channelsDirName && d.pubsub {
+			return &channelsDir{redisFS: d.redisFS}, nil
+		}
+		if name == computeDirName && d.compute {
+			return &computeDir{redisFS: d.redisFS}, nil
+		}
+		if name == currentName {
+			sel := d.selection()
+			if sel == "" {
+				return nil, syscall.ENOENT
+			}
+			// the selection names an entry of the root like any other
+			key := d.childKey(ctx, sel)
+			if !d.visible(key) {
+				return nil, syscall.ENOENT
+			}
+			return d.keyNode(ctx, key)
+		}
+	}
+
+	name = d.childKey(ctx, name)
+	if d.keyspace() && !d.visible(name) {
+		return nil, syscall.ENOENT
+	}
+
+	if d.t == "hash" {
+		ok, err := d.client.HExists(ctx, d.name, name).Result()
+		if err != nil {
+			return nil, errno(err)
+		}
+		if !ok {
+			return nil, syscall.ENOENT
+		}
+
+		return d.file(&redisFile{
+			name:    name,
+			parent:  d.name,
+			pt:      "hash",
+			redisFS: d.redisFS,
+		}), nil
+	}
+
+	if d.t == "list" {
+		return d.lookupListElem(ctx, name)
+	}
+
+	if d.t == "stream" {
+		switch name {
+		case groupsDirName:
+			return &groupsDir{stream: d.name, redisFS: d.redisFS}, nil
+		case tailFileName:
+			return &tailFile{stream: d.name, redisFS: d.redisFS}, nil
+		}
+
+		// XRANGE fails on anything but an ID, which would surface as EIO,
+		// and auto IDs like "*" only name entries yet to be created
+		if !streamIDRe.MatchString(name) || strings.HasSuffix(name, "*") {
+			return nil, syscall.ENOENT
+		}
+
+		msgs, err := d.client.XRange(ctx, d.name, name, name).Result()
+		if err != nil {
+			return nil, errno(err)
+		}
+		if len(msgs) == 0 {
+			return nil, syscall.ENOENT
+		}
+
+		return d.file(&redisFile{
+			name:    name,
+			parent:  d.name,
+			pt:      "stream",
+			redisFS: d.redisFS,
+		}), nil
+	}
 
-	ok, err := d.client.Exists(name).Result()
-	if err == redis.Nil || ok != 1 {
+	if d.keyspace() && d.missing.get(name) {
 		return nil, syscall.ENOENT
 	}
-	if err != nil {
-		return nil, syscall.EIO
+	n, err := d.keyNode(ctx, name)
+	if err == syscall.ENOENT && d.keyspace() {
+		if n, err := d.lookupSidecar(ctx, name); err != syscall.ENOENT {
+			return n, err
+		}
+		n, err = d.lookupNamespace(ctx, name)
+		if err == syscall.ENOENT {
+			d.missing.set(name)
+		}
 	}
+	return n, err
+}
+
+// keyNode returns the node for a top-level key, a directory for streams and
+// hashes and a file otherwise.
+func (d *redisDir) keyNode(ctx context.Context, name string) (fs.Node, error) {
 
-	t, err := d.client.Type(name).Result()
-	if err == redis.Nil || ok != 1 {
+	t, err := d.keyType(ctx, name)
+	if err == redis.Nil || t == "none" {
 		return nil, syscall.ENOENT
 	}
 	if err != nil {
-		return nil, syscall.EIO
+		return nil, errno(err)
 	}
 
-	if t == "stream" {
+	if d.isDir(t) {
 		return &redisDir{
 			name:    name,
 			redisFS: d.redisFS,
-			t:       "stream",
+			t:       t,
 		}, nil
 	}
 
-	return &redisFile{
+	return d.file(&redisFile{
 		name:    name,
+		t:       t,
 		redisFS: d.redisFS,
-	}, nil
+	}), nil
 }
 
-func (d *redisDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+func (d *redisDir) ReadDirAll(ctx context.Context) (dirents []fuse.Dirent, err error) {
+	defer observeOp("readdir", &err)
+	ctx, span := startSpan(ctx, "ReadDirAll", d.name+d.ns)
+	defer func() { endSpan(span, err, attribute.Int("rsfs.entries", len(dirents))) }()
 
-	if d.root {
-		keys, err := d.client.Keys("*").Result()
+	if d.keyspace() {
+		keys, err := d.scanKeys(ctx, globEscape(d.prefix+d.ns)+"*")
 		if err != nil {
-			return nil, syscall.EIO
+			return nil, errno(err)
 		}
 
-		entries := make([]fuse.Dirent, len(keys))
-		for i := 0; i < len(keys); i++ {
-			entries[i].Name = keys[i]
-			t, err := d.client.Type(keys[i]).Result()
-			if err != nil {
-				return nil, syscall.EIO
-			}
-			if t == "stream" {
-				entries[i].Type = fuse.DT_Dir
-			} else if t == "string" {
-				entries[i].Type = fuse.DT_File
-			}
+		keys, dirs := d.splitNamespaces(keys)
+		entries, err := d.keyEntries(ctx, keys)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, dirs...)
+		if d.root {
+			entries = append(entries, d.rootExtras()...)
 		}
-
 		return entries, nil
 	}
 
+	switch d.t {
+	case "hash":
+		return d.readHashDir(ctx)
+	case "stream":
+		return d.readStreamDir(ctx)
+	case "list":
+		return d.readListDir(ctx)
+	}
+
 	return nil, nil
 }
 
-func (d *redisDir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fs.Node, fs.Handle, error) {
+// keyEntries turns a batch of scanned root keys into dirents, typing them
+// with one pipelined round-trip.
+func (d *redisDir) keyEntries(ctx context.Context, keys []string) ([]fuse.Dirent, error) {
 
-	resp.Flags |= fuse.OpenDirectIO
+	visible := keys[:0]
+	for _, k := range keys {
+		if d.visible(k) {
+			visible = append(visible, k)
+		}
+	}
+	keys = visible
 
-	f := &redisFile{
-		parent:  d.name,
-		name:    req.Name,
-		redisFS: d.redisFS,
+	// queue all TYPE commands so the listing costs one round-trip
+	types := make([]*redis.StatusCmd, len(keys))
+	_, err := d.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i := range keys {
+			types[i] = pipe.Type(ctx, keys[i])
+		}
+		return nil
+	})
+	if err != nil && !d.skipErrors {
+		return nil, errno(err)
 	}
 
-	return f, f, nil
+	entries := make([]fuse.Dirent, len(keys))
+	for i := 0; i < len(keys); i++ {
+		if err := types[i].Err(); err != nil {
+			entries[i].Name = d.childName(keys[i], "")
+			// listed with DT_Unknown, Lookup retries the TYPE
+			slog.Warn("redis command failed", "op", "ReadDirAll:Type", "key", keys[i], "err", err)
+			continue
+		}
+		t := types[i].Val()
+		entries[i].Name = d.childName(keys[i], t)
+		d.types.set(keys[i], t)
+		if d.isDir(t) {
+			entries[i].Type = fuse.DT_Dir
+		} else if t == "string" {
+			entries[i].Type = fuse.DT_File
+		}
+	}
+
+	return entries, nil
 }
 
-func (d *redisDir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error) {
-	xAddArgs := &redis.XAddArgs{
-		Stream: req.Name,
-		Values: map[string]interface{}{
-			"blob": "dummy",
-		},
-		ID: "0-1",
+// rootExtras are the synthetic entries listed after the keys at the root.
+func (d *redisDir) rootExtras() []fuse.Dirent {
+
+	var entries []fuse.Dirent
+	for name := range d.synthFiles() {
+		entries = append(entries, fuse.Dirent{
+			Name: name,
+			Type: fuse.DT_File,
+		})
+	}
+	if d.pubsub {
+		entries = append(entries, fuse.Dirent{Name: channelsDirName, Type: fuse.DT_Dir})
+	}
+	if d.compute {
+		entries = append(entries, fuse.Dirent{Name: computeDirName, Type: fuse.DT_Dir})
 	}
+	if sel := d.selection(); sel != "" && d.visible(d.prefix+d.keyName(sel)) {
+		entries = append(entries, fuse.Dirent{Name: currentName})
+	}
+	return entries
+}
 
-	_, err := d.client.XAdd(xAddArgs).Result()
+func (d *redisDir) readStreamDir(ctx context.Context) ([]fuse.Dirent, error) {
+
+	msgs, err := d.client.XRange(ctx, d.name, "-", "+").Result()
 	if err != nil {
-		fmt.Println("Mkdir:XAdd", err, xAddArgs.Stream, xAddArgs.ID)
-		return nil, syscall.EIO
+		return nil, errno(err)
 	}
 
-	_, err = d.client.XDel(xAddArgs.Stream, xAddArgs.ID).Result()
-	if err != nil {
-		fmt.Println("Mkdir:XDel", err, xAddArgs.Stream, xAddArgs.ID)
-		return nil, syscall.EIO
+	entries := make([]fuse.Dirent, len(msgs), len(msgs)+2)
+	for i := range msgs {
+		entries[i].Name = msgs[i].ID
+		entries[i].Type = fuse.DT_File
 	}
+	entries = append(entries,
+		fuse.Dirent{Name: groupsDirName, Type: fuse.DT_Dir},
+		fuse.Dirent{Name: tailFileName, Type: fuse.DT_File},
+	)
 
-	return &redisDir{
-		name:    req.Name,
-		redisFS: d.redisFS,
-		t:       "stream",
-	}, nil
+	return entries, nil
 }
 
-type redisFile struct {
-	name   string
-	parent string
-	size   uint64
-	rb     []byte
-	wb     []byte
-	ro     bool
-	mu     sync.RWMutex
-	*redisFS
-}
+func (d *redisDir) readHashDir(ctx context.Context) ([]fuse.Dirent, error) {
 
-func (f *redisFile) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
-	if req.Flags.IsReadOnly() && !req.Dir {
-		f.ro = false
+	var entries []fuse.Dirent
+	seen := make(map[string]struct{})
+
+	var cursor uint64
+	for {
+		// HSCAN returns field/value pairs and may repeat fields
+		kvs, next, err := d.client.HScan(ctx, d.name, cursor, "", d.scanCount).Result()
+		if err != nil {
+			return nil, errno(err)
+		}
+		for i := 0; i < len(kvs); i += 2 {
+			if _, ok := seen[kvs[i]]; ok {
+				continue
+			}
+			seen[kvs[i]] = struct{}{}
+			entries = append(entries, fuse.Dirent{
+				Name: d.childName(kvs[i], ""),
+				Type: fuse.DT_File,
+			})
+		}
+		cursor = next
+		if cursor == 0 {
+			break
+		}
 	}
-	resp.Flags |= fuse.OpenDirectIO
-	return f, nil
-}
 
-func (f *redisFile) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
-	f.mu.Lock()
-	defer f.mu.Unlock()
-	f.wb = append(f.wb, req.Data...)
-	resp.Size = len(req.Data)
-	return nil
+	return entries, nil
 }
 
-func (f *redisFile) Flush(ctx context.Context, req *fuse.FlushRequest) error {
+func (d *redisDir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fs.Node, fs.Handle, error) {
 
-	f.mu.Lock()
-	defer f.mu.Unlock()
+	if d.readOnly {
+		return nil, nil, syscall.EROFS
+	}
 
-	if f.ro {
-		return nil
+	name := d.childKey(ctx, req.Name)
+	if d.childProtected(name) {
+		return nil, nil, syscall.EROFS
+	}
+	if d.t == "stream" && streamID(name) == "" {
+		return nil, nil, syscall.EINVAL
+	}
+	if d.t == "list" {
+		// LSET cannot add elements, only existing indexes can be written
+		return nil, nil, syscall.EPERM
 	}
 
-	if f.parent != "" {
-		// stream
-		xAddArgs := &redis.XAddArgs{
-			Stream: f.parent,
-			Values: map[string]interface{}{
-				"blob": f.wb,
-			},
-			ID: f.name + "-0",
+	// with -type-suffix, creating "x.list" starts a new list x
+	var t string
+	if d.keyspace() && d.typeSuffix {
+		for _, st := range suffixTypes {
+			base := strings.TrimSuffix(name, "."+st)
+			if base == name {
+				continue
+			}
+			if bt, err := d.keyType(ctx, base); err == nil && (bt == "none" || bt == st) {
+				name, t = base, st
+			}
+			break
 		}
+	}
 
-		_, err := f.client.XAdd(xAddArgs).Result()
-		if err != nil {
-			fmt.Println("Flush:XAdd", err, xAddArgs.Stream, xAddArgs.ID)
-			return syscall.EIO
-		}
-	} else {
-		// string
-		_, err := f.client.Set(f.name, f.wb, 0).Result()
-		if err != nil {
-			fmt.Println("Flush:Set", err, f.name)
-			return syscall.EIO
-		}
+	resp.Flags |= fuse.OpenDirectIO
+	d.missing.invalidate(name)
+
+	if base := strings.TrimSuffix(name, dumpSuffix); d.keyspace() && d.dumpFiles && base != name {
+		// a new sidecar, RESTOREd into base once written
+		f := &dumpFile{key: base, redisFS: d.redisFS}
+		return f, &dumpHandle{f: f}, nil
 	}
 
-	f.wb = nil
-	return nil
-}
+	f := d.file(&redisFile{
+		parent:  d.name,
+		pt:      d.t,
+		name:    name,
+		t:       t,
+		redisFS: d.redisFS,
+	})
 
-func (f *redisFile) Attr(ctx context.Context, a *fuse.Attr) error {
-	// fill fuse.Attr
-	a.Valid = f.attrValidity
-	a.Size = f.size
-	a.Mode = 0444
-	return nil
+	// a created file must exist even if nothing is written to it
+	h := f.newHandle(false)
+	h.pid = req.Pid
+	h.dirty = true
+
+	return f, h, nil
 }
 
-func (f *redisFile) reloadFile(ctx context.Context) error {
+// mkdirGroup is the consumer group Mkdir briefly creates to make a stream.
+const mkdirGroup = "rsfs-mkdir"
 
-	t, err := f.client.Type(f.name).Result()
-	if err == redis.Nil {
-		return syscall.ENOENT
+func (d *redisDir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error) {
+	if d.readOnly {
+		return nil, syscall.EROFS
 	}
-	if err != nil {
-		return syscall.EIO
+	if !d.keyspace() {
+		// directories inside keys are their fields or entries, not keys
+		return nil, syscall.EPERM
 	}
 
-	var b []byte
-	switch t {
+	name := d.childKey(ctx, req.Name)
+	if d.childProtected(name) {
+		return nil, syscall.EROFS
+	}
+
+	n, err := d.client.Exists(ctx, name).Result()
+	if err != nil {
+		slog.Error("redis command failed", "op", "Mkdir:Exists", "key", name, "err", err)
+		return nil, errno(err)
+	}
+	if n > 0 {
+		return nil, syscall.EEXIST
+	}
+
+	// MKSTREAM creates an empty stream without touching its ID sequence,
+	// the group is only a vehicle for that and is dropped in the same
+	// MULTI, so no client ever sees it
+	_, err = d.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XGroupCreateMkStream(ctx, name, mkdirGroup, "$")
+		pipe.XGroupDestroy(ctx, name, mkdirGroup)
+		return nil
+	})
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "BUSYGROUP") || strings.HasPrefix(err.Error(), "WRONGTYPE") {
+			// created concurrently by another client
+			return nil, syscall.EEXIST
+		}
+		slog.Error("redis command failed", "op", "Mkdir:XGroupCreate", "key", name, "err", err)
+		return nil, errno(err)
+	}
+
+	d.invalidate(name)
+
+	return &redisDir{
+		name:    name,
+		redisFS: d.redisFS,
+		t:       "stream",
+	}, nil
+}
+
+func (d *redisDir) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
+
+	if d.readOnly {
+		return syscall.EROFS
+	}
+
+	name := d.childKey(ctx, req.Name)
+	if d.childProtected(name) {
+		return syscall.EROFS
+	}
+
+	var n int64
+	var err error
+	switch d.t {
+	case "hash":
+		n, err = d.client.HDel(ctx, d.name, name).Result()
+	case "stream":
+		n, err = d.client.XDel(ctx, d.name, name).Result()
+	case "list":
+		// removing an element would renumber all that follow it
+		return syscall.EPERM
+	default:
+		// files and stream/hash directories are all plain keys at the root
+		if d.safeDelete {
+			n, err = d.safeDel(ctx, name, req.Dir, d.knownType(fileID{d.t, d.name, name}))
+		} else {
+			n, err = d.client.Del(ctx, name).Result()
+		}
+		d.invalidate(name)
+		if err == nil && n > 0 && d.persistMeta {
+			d.client.Del(ctx, metaKey(name))
+		}
+	}
+	if err == errTypeChanged || err == redis.TxFailedErr {
+		slog.Warn("key changed type, not removed", "op", "Remove:Watch", "key", name)
+		return syscall.EAGAIN
+	}
+	if err != nil {
+		slog.Error("redis command failed", "op", "Remove", "key", d.name, "field", name, "err", err)
+		return errno(err)
+	}
+	if n == 0 {
+		return syscall.ENOENT
+	}
+	d.unlink(fileID{d.t, d.name, name})
+
+	return nil
+}
+
+// Rename maps to RENAME, which overwrites an existing destination key just
+// like rename(2) replaces an existing file, or with -rename-no-clobber to
+// RENAMENX, failing with EEXIST instead. Hash fields move in a WATCH
+// transaction. Moves between different directories return EXDEV so tools
+// like mv fall back to copy+delete.
+func (d *redisDir) Rename(ctx context.Context, req *fuse.RenameRequest, newDir fs.Node) error {
+
+	if d.readOnly {
+		return syscall.EROFS
+	}
+
+	// keys move freely between namespaces, fields and entries stay put
+	nd, ok := newDir.(*redisDir)
+	if !ok || nd.keyspace() != d.keyspace() || (!d.keyspace() && nd.name != d.name) {
+		return syscall.EXDEV
+	}
+
+	oldName, newName := d.childKey(ctx, req.OldName), nd.childKey(ctx, req.NewName)
+	if d.keyspace() {
+		// like Create, "y.list" names list y when a list moves there
+		if t, err := d.keyType(ctx, oldName); err == nil {
+			if suffix := nd.nameSuffix(t); suffix != "" {
+				newName = strings.TrimSuffix(newName, suffix)
+			}
+		}
+	}
+	if d.childProtected(oldName) || nd.childProtected(newName) {
+		return syscall.EROFS
+	}
+
+	switch d.t {
+	case "hash":
+		// the value moved and, with -rename-no-clobber, the missing
+		// destination must still hold when the MULTI runs
+		err := d.client.Watch(ctx, func(tx *redis.Tx) error {
+			v, err := tx.HGet(ctx, d.name, oldName).Result()
+			if err != nil {
+				return err
+			}
+			if d.noClobber {
+				exists, err := tx.HExists(ctx, d.name, newName).Result()
+				if err != nil {
+					return err
+				}
+				if exists {
+					return syscall.EEXIST
+				}
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.HSet(ctx, d.name, newName, v)
+				pipe.HDel(ctx, d.name, oldName)
+				return nil
+			})
+			return err
+		}, d.name)
+		if err == redis.Nil {
+			return syscall.ENOENT
+		}
+		if err == syscall.EEXIST {
+			return err
+		}
+		if err == redis.TxFailedErr {
+			slog.Warn("hash changed, not renamed", "op", "Rename:Watch", "key", d.name, "from", oldName, "to", newName)
+			return syscall.EAGAIN
+		}
+		if err != nil {
+			slog.Error("redis command failed", "op", "Rename:HSet", "key", d.name, "from", oldName, "to", newName, "err", err)
+			return errno(err)
+		}
+	case "stream", "list":
+		// entry IDs are assigned by Redis and list indexes by position
+		return syscall.EXDEV
+	default:
+		var err error
+		if d.noClobber {
+			var renamed bool
+			renamed, err = d.client.RenameNX(ctx, oldName, newName).Result()
+			if err == nil && !renamed {
+				return syscall.EEXIST
+			}
+		} else {
+			err = d.client.Rename(ctx, oldName, newName).Err()
+		}
+		d.invalidate(oldName)
+		d.invalidate(newName)
+		if err != nil && err.Error() == "ERR no such key" {
+			return syscall.ENOENT
+		}
+		if err != nil {
+			slog.Error("redis command failed", "op", "Rename", "from", oldName, "to", newName, "err", err)
+			return errno(err)
+		}
+		if d.persistMeta {
+			// separate command, the meta hash may live in another slot
+			err := d.client.Rename(ctx, metaKey(oldName), metaKey(newName)).Err()
+			if err != nil && err.Error() == "ERR no such key" {
+				d.client.Del(ctx, metaKey(newName))
+			} else if err != nil {
+				slog.Warn("redis command failed", "op", "Rename:Meta", "from", oldName, "to", newName, "err", err)
+			}
+		}
+	}
+	d.unlink(fileID{d.t, d.name, oldName})
+	d.unlink(fileID{d.t, d.name, newName})
+
+	return nil
+}
+
+type redisFile struct {
+	name    string
+	parent  string
+	pt      string
+	t       string
+	size    uint64
+	sizeAt  time.Time
+	atime   time.Time
+	id      string
+	meta    map[string]string
+	handles map[*redisHandle]struct{}
+	// rendered is the size of the last render of a list, set, zset,
+	// stream or hash and its element count, zero if not rendered yet
+	rendered struct {
+		size uint64
+		n    int64
+	}
+	mu sync.RWMutex
+	*redisFS
+}
+
+// redisHandle is one open instance of a redisFile, so concurrent opens of
+// the same key never share write buffers.
+type redisHandle struct {
+	f     *redisFile
+	rb    []byte
+	wb    []byte
+	ro    bool
+	dirty bool
+	// loaded handles hold the value in wb that their writes go over
+	loaded bool
+	// append handles collect only the new data and APPEND it to strings
+	// or push its lines onto lists
+	append bool
+	// streamed handles have sent their data with SETRANGE as it was
+	// written, hw is the end of the highest write
+	streamed bool
+	hw       int64
+	// pend holds contiguous streamed writes at pendOff merged within
+	// -write-coalesce of pendAt, not yet sent
+	pend    []byte
+	pendOff int64
+	pendAt  time.Time
+	// base is the value a string handle started from with
+	// -optimistic-locking, nil when not tracked
+	base *keyVersion
+	// pid opened the handle, telling its O_TRUNC apart from other opens
+	pid uint32
+	mu  sync.Mutex
+}
+
+var streamIDRe = regexp.MustCompile(`^[0-9]+(-([0-9]+|\*))?$`)
+
+// streamID maps a file name in a stream directory to the XADD ID. A bare
+// millisecond time gets sequence 0 and "*" lets Redis pick the ID.
+// It returns "" if name is not a valid stream ID.
+func streamID(name string) string {
+	switch {
+	case name == "*":
+		return name
+	case !streamIDRe.MatchString(name):
+		return ""
+	case !strings.Contains(name, "-"):
+		return name + "-0"
+	}
+	return name
+}
+
+// key returns the Redis key backing the file, which for hash fields and
+// stream entries is the containing key.
+func (f *redisFile) key() string {
+	if f.pt != "" {
+		return f.parent
+	}
+	return f.name
+}
+
+// immutable reports whether writes to f are refused, on a read-only mount or
+// for a key matching -readonly-keys.
+func (f *redisFile) immutable() bool {
+	return f.readOnly || f.protected(f.key())
+}
+
+// childProtected reports whether the key holding child name matches
+// -readonly-keys.
+func (d *redisDir) childProtected(name string) bool {
+	if d.keyspace() {
+		return d.protected(name)
+	}
+	return d.protected(d.name)
+}
+
+func (f *redisFile) newHandle(ro bool) *redisHandle {
+	h := &redisHandle{
+		f:  f,
+		ro: ro,
+	}
+
+	f.mu.Lock()
+	if f.handles == nil {
+		f.handles = make(map[*redisHandle]struct{})
+	}
+	f.handles[h] = struct{}{}
+	f.mu.Unlock()
+
+	return h
+}
+
+func (f *redisFile) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	if f.immutable() && !req.Flags.IsReadOnly() {
+		return nil, syscall.EROFS
+	}
+	resp.Flags |= fuse.OpenDirectIO
+	// read-only opens must never write back on Flush
+	h := f.newHandle(req.Flags.IsReadOnly())
+	h.pid = req.Pid
+	f.mu.RLock()
+	h.append = req.Flags&fuse.OpenAppend != 0 && f.pt == "" &&
+		(f.t == "" || f.t == "string" || (f.t == "list" && f.listFormat != "json"))
+	track := f.optimistic && !h.ro && !h.append && f.pt == "" && (f.t == "" || f.t == "string")
+	f.mu.RUnlock()
+	if track {
+		if err := h.snapshot(ctx); err != nil {
+			h.Release(ctx, nil)
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+func (f *redisFile) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	if f.immutable() {
+		return syscall.EROFS
+	}
+
+	if req.Valid.Size() {
+		if f.maxWriteBuf > 0 && req.Size > uint64(f.maxWriteBuf) {
+			return syscall.EFBIG
+		}
+
+		f.mu.RLock()
+		handles := make([]*redisHandle, 0, len(f.handles))
+		for h := range f.handles {
+			handles = append(handles, h)
+		}
+		f.mu.RUnlock()
+
+		// merged writes land before the truncation, as they were issued
+		for _, h := range handles {
+			h.mu.Lock()
+			err := h.sendPending(ctx)
+			h.mu.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+
+		// truncate or zero-extend the buffers holding unflushed writes, an
+		// open handle that wrote nothing must not start writing back. The
+		// handle of an O_TRUNC open, from the same process, is emptied
+		// instead of the key, which is only replaced once new content
+		// flushes and parses
+		own := req.Valid.Handle() && req.Size == 0
+		truncated, buffered := false, false
+		for _, h := range handles {
+			h.mu.Lock()
+			switch {
+			case h.streamed:
+				if !truncated {
+					if err := f.truncateKey(ctx, req.Size); err != nil {
+						h.mu.Unlock()
+						return err
+					}
+					truncated = true
+				}
+				h.hw = int64(req.Size)
+			case h.dirty && req.Size <= uint64(len(h.wb)):
+				h.wb = h.wb[:req.Size]
+				buffered = true
+			case h.dirty:
+				h.wb = append(h.wb, make([]byte, req.Size-uint64(len(h.wb)))...)
+				buffered = true
+			case own && !h.ro && !h.append && h.pid == req.Pid:
+				h.wb = h.wb[:0]
+				h.dirty = true
+				buffered = true
+			case h.loaded:
+				// reload before the next write instead of writing
+				// over the old value
+				h.wb = nil
+				h.loaded = false
+			}
+			h.mu.Unlock()
+		}
+
+		if !truncated && !buffered {
+			if err := f.truncateKey(ctx, req.Size); err != nil {
+				return err
+			}
+			// with -optimistic-locking our own truncate is no conflict
+			for _, h := range handles {
+				h.mu.Lock()
+				var err error
+				if h.base != nil {
+					err = h.snapshot(ctx)
+				}
+				h.mu.Unlock()
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		f.mu.Lock()
+		f.size = req.Size
+		f.sizeAt = time.Now()
+		f.mu.Unlock()
+	}
+
+	if err := f.saveMeta(ctx, req); err != nil {
+		return err
+	}
+
+	return f.Attr(ctx, &resp.Attr)
+}
+
+func (h *redisHandle) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) (err error) {
+	defer observeOp("write", &err)
+
+	f := h.f
+	if f.immutable() {
+		return syscall.EROFS
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	end := int(req.Offset) + len(req.Data)
+	if h.append {
+		end = len(h.wb) + len(req.Data)
+	} else if !h.dirty && !h.loaded {
+		if err := h.load(ctx); err != nil {
+			return err
+		}
+	}
+	if h.streamed || (f.writeThrough > 0 && int64(end) > f.writeThrough && h.canStream()) {
+		return h.writeRange(ctx, req, resp, end)
+	}
+	if f.maxWriteBuf > 0 && int64(end) > f.maxWriteBuf {
+		return syscall.EFBIG
+	}
+
+	h.dirty = true
+	resp.Size = len(req.Data)
+
+	if h.append {
+		// the kernel places appends at the current size, which wb lacks
+		h.wb = append(h.wb, req.Data...)
+		f.mu.Lock()
+		f.size += uint64(len(req.Data))
+		f.mu.Unlock()
+		return nil
+	}
+
+	if end > len(h.wb) {
+		h.wb = append(h.wb, make([]byte, end-len(h.wb))...)
+	}
+	copy(h.wb[req.Offset:], req.Data)
+
+	f.mu.Lock()
+	f.size = uint64(len(h.wb))
+	f.sizeAt = time.Now()
+	f.mu.Unlock()
+	return nil
+}
+
+// load fills wb with the current value before the first write of a handle
+// that did not truncate, so writes at an offset keep the bytes around them.
+// Strings past -write-through-size are not fetched, writes go through with
+// SETRANGE from the start. The caller holds h.mu.
+func (h *redisHandle) load(ctx context.Context) error {
+
+	f := h.f
+
+	if f.pt == "stream" {
+		// entries are only ever written whole
+		h.loaded = true
+		return nil
+	}
+
+	if f.writeThrough > 0 && h.canStream() {
+		n, err := f.client.StrLen(ctx, f.name).Result()
+		if err != nil {
+			slog.Error("redis command failed", "op", "Write:StrLen", "key", f.name, "err", err)
+			return errno(err)
+		}
+		if n > f.writeThrough {
+			h.streamed = true
+			h.hw = n
+			h.loaded = true
+			return nil
+		}
+	}
+
+	f.mu.Lock()
+	b, err := f.reloadFile(ctx)
+	f.mu.Unlock()
+	if err != nil && err != syscall.ENOENT {
+		return err
+	}
+	// the cache may share b
+	h.wb = append(h.wb[:0], b...)
+	h.loaded = true
+	return nil
+}
+
+// canStream reports whether writes may go straight to Redis, which only
+// works for plain strings. The caller holds h.mu.
+func (h *redisHandle) canStream() bool {
+	f := h.f
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return !h.append && h.base == nil && !f.noCommit && f.pt == "" && (f.t == "" || f.t == "string")
+}
+
+// writeRange writes through with SETRANGE so large files never sit in
+// memory. The caller holds h.mu.
+func (h *redisHandle) writeRange(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse, end int) error {
+
+	f := h.f
+
+	if !h.streamed {
+		// the buffered prefix replaces the value, as a buffered flush would
+		if err := f.client.Set(ctx, f.name, h.wb, 0).Err(); err != nil {
+			slog.Error("redis command failed", "op", "Write:Set", "key", f.name, "err", err)
+			return errno(err)
+		}
+		h.streamed = true
+		h.hw = int64(len(h.wb))
+		h.wb = nil
+	}
+
+	if f.coalesce > 0 && len(h.pend) > 0 && req.Offset == h.pendOff+int64(len(h.pend)) &&
+		time.Since(h.pendAt) < f.coalesce && int64(len(h.pend)+len(req.Data)) <= f.writeThrough {
+		h.pend = append(h.pend, req.Data...)
+		writeRequests.WithLabelValues("merged").Inc()
+	} else {
+		if err := h.sendPending(ctx); err != nil {
+			return err
+		}
+		if f.coalesce > 0 {
+			h.pend, h.pendOff, h.pendAt = append(h.pend[:0], req.Data...), req.Offset, time.Now()
+		} else if err := f.client.SetRange(ctx, f.name, req.Offset, string(req.Data)).Err(); err != nil {
+			slog.Error("redis command failed", "op", "Write:SetRange", "key", f.name, "offset", req.Offset, "err", err)
+			return errno(err)
+		}
+		writeRequests.WithLabelValues("sent").Inc()
+	}
+	if int64(end) > h.hw {
+		h.hw = int64(end)
+	}
+	h.dirty = true
+	resp.Size = len(req.Data)
+
+	f.mu.Lock()
+	f.size = uint64(h.hw)
+	f.sizeAt = time.Now()
+	f.mu.Unlock()
+	return nil
+}
+
+// sendPending writes out the merged streamed writes. The caller holds h.mu.
+func (h *redisHandle) sendPending(ctx context.Context) error {
+
+	if len(h.pend) == 0 {
+		return nil
+	}
+
+	f := h.f
+	if err := f.client.SetRange(ctx, f.name, h.pendOff, string(h.pend)).Err(); err != nil {
+		slog.Error("redis command failed", "op", "Write:SetRange", "key", f.name, "offset", h.pendOff, "err", err)
+		return errno(err)
+	}
+	h.pend = h.pend[:0]
+	return nil
+}
+
+// truncateKey resizes the value behind f to size bytes in Redis, for
+// handles whose data was already written through and for truncates with no
+// open handle to buffer them.
+func (f *redisFile) truncateKey(ctx context.Context, size uint64) error {
+
+	if f.noCommit {
+		slog.Debug("discarding truncate", "op", "Setattr:NoCommit", "key", f.key(), "field", f.name, "size", size)
+		return nil
+	}
+
+	f.mu.RLock()
+	t := f.t
+	f.mu.RUnlock()
+
+	var b []byte
+	var err error
+	switch {
+	case f.pt == "stream":
+		// entries cannot change once added
+		return nil
+	case f.pt == "" && t != "" && t != "string":
+		// rendered types have no bytes to cut, only emptying them works
+		if size > 0 {
+			return syscall.ENOTSUP
+		}
+		err = f.client.Del(ctx, f.name).Err()
+		f.invalidate(f.name)
+		if err != nil {
+			slog.Error("redis command failed", "op", "Setattr:Del", "key", f.name, "err", err)
+			return errno(err)
+		}
+		return nil
+	case size == 0:
+	case f.pt == "hash":
+		b, err = f.client.HGet(ctx, f.parent, f.name).Bytes()
+	case f.pt == "list":
+		i, _ := listIndex(f.name)
+		b, err = f.client.LIndex(ctx, f.parent, i).Bytes()
+	default:
+		b, err = f.client.GetRange(ctx, f.name, 0, int64(size)-1).Bytes()
+	}
+	if err != nil && err != redis.Nil {
+		return errno(err)
+	}
+	if uint64(len(b)) > size {
+		b = b[:size]
+	}
+	if uint64(len(b)) < size {
+		b = append(b, make([]byte, size-uint64(len(b)))...)
+	}
+
+	if f.pt == "list" {
+		err := f.setListElem(ctx, b)
+		f.invalidate(f.key())
+		return err
+	}
+	if f.pt == "hash" {
+		err = f.client.HSet(ctx, f.parent, f.name, b).Err()
+	} else {
+		err = f.client.Set(ctx, f.name, b, 0).Err()
+	}
+	f.invalidate(f.key())
+	if err != nil {
+		slog.Error("redis command failed", "op", "Setattr:Set", "key", f.key(), "field", f.name, "err", err)
+		return errno(err)
+	}
+	return nil
+}
+
+func (h *redisHandle) Flush(ctx context.Context, req *fuse.FlushRequest) (err error) {
+	defer observeOp("flush", &err)
+
+	f := h.f
+	ctx, span := startSpan(ctx, "Flush", f.key())
+	defer func() { endSpan(span, err, attribute.Int("rsfs.size", len(h.wb))) }()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if f.immutable() {
+		if h.dirty {
+			return syscall.EROFS
+		}
+		return nil
+	}
+
+	return h.commit(ctx)
+}
+
+// commit writes the handle's buffer back to Redis if it changed since the
+// last commit. The caller must hold h.mu.
+func (h *redisHandle) commit(ctx context.Context) error {
+
+	f := h.f
+
+	if h.ro || !h.dirty {
+		return nil
+	}
+
+	if f.noCommit {
+		slog.Debug("discarding write", "op", "Flush:NoCommit", "key", f.key(), "field", f.name, "bytes", len(h.wb))
+		h.dirty = false
+		return nil
+	}
+
+	switch f.pt {
+	case "hash":
+		_, err := f.client.HSet(ctx, f.parent, f.name, h.wb).Result()
+		if err != nil {
+			slog.Error("redis command failed", "op", "Flush:HSet", "key", f.parent, "field", f.name, "err", err)
+			return errno(err)
+		}
+	case "stream":
+		id := streamID(f.name)
+		if id == "" {
+			return syscall.EINVAL
+		}
+
+		xAddArgs := &redis.XAddArgs{
+			Stream: f.parent,
+			Values: streamValues(h.wb),
+			ID:     id,
+			MaxLen: f.streamMaxLen,
+			Approx: f.streamApprox,
+		}
+
+		id, err := f.client.XAdd(ctx, xAddArgs).Result()
+		if err != nil {
+			slog.Error("redis command failed", "op", "Flush:XAdd", "key", xAddArgs.Stream, "id", xAddArgs.ID, "err", err)
+			return errno(err)
+		}
+
+		f.mu.Lock()
+		f.id = id
+		f.mu.Unlock()
+	case "list":
+		if err := f.setListElem(ctx, h.wb); err != nil {
+			return err
+		}
+	default:
+		f.mu.RLock()
+		t := f.t
+		f.mu.RUnlock()
+		if h.streamed {
+			// the data already went out with SETRANGE, but for the
+			// last merged writes
+			if err := h.sendPending(ctx); err != nil {
+				return err
+			}
+			break
+		}
+		if h.append {
+			var err error
+			if t == "list" {
+				// each appended line becomes a new element
+				var values []interface{}
+				for _, v := range bytes.Split(bytes.TrimSuffix(h.wb, []byte{'\n'}), []byte{'\n'}) {
+					values = append(values, v)
+				}
+				if len(h.wb) > 0 && f.listPush == "left" {
+					err = f.client.LPush(ctx, f.name, values...).Err()
+				} else if len(h.wb) > 0 {
+					err = f.client.RPush(ctx, f.name, values...).Err()
+				}
+			} else {
+				err = f.client.Append(ctx, f.name, string(h.wb)).Err()
+			}
+			if err != nil {
+				slog.Error("redis command failed", "op", "Flush:Append", "key", f.name, "err", err)
+				return errno(err)
+			}
+			// appended data must not be sent again by a later flush
+			h.wb = nil
+			break
+		}
+		if h.base != nil {
+			if err := h.compareAndSet(ctx, h.wb); err != nil {
+				return err
+			}
+			break
+		}
+		if err := f.flushKey(ctx, t, h.wb); err != nil {
+			return err
+		}
+	}
+
+	if f.defaultTTL > 0 {
+		if _, err := f.client.Expire(ctx, f.key(), f.defaultTTL).Result(); err != nil {
+			slog.Error("redis command failed", "op", "Flush:Expire", "key", f.key(), "err", err)
+			return errno(err)
+		}
+	}
+
+	f.invalidate(f.key())
+
+	// the next Attr must pick up what was just written
+	f.mu.Lock()
+	f.sizeAt = time.Time{}
+	f.mu.Unlock()
+
+	h.dirty = false
+	return nil
+}
+
+// Fsync commits every open handle so write-then-fsync gets a durability
+// point before close.
+func (f *redisFile) Fsync(ctx context.Context, req *fuse.FsyncRequest) error {
+
+	f.mu.RLock()
+	handles := make([]*redisHandle, 0, len(f.handles))
+	for h := range f.handles {
+		handles = append(handles, h)
+	}
+	f.mu.RUnlock()
+
+	for _, h := range handles {
+		h.mu.Lock()
+		err := h.commit(ctx)
+		h.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (h *redisHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	h.f.mu.Lock()
+	delete(h.f.handles, h)
+	h.f.mu.Unlock()
+	return nil
+}
+
+// readPop consumes the key on the first read of each open: a list gives up
+// its head element and a string is fetched and deleted with GETDEL.
+func (h *redisHandle) readPop(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+
+	f := h.f
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.rb == nil {
+		t, err := f.keyType(ctx, f.name)
+		if err != nil {
+			return errno(err)
+		}
+
+		var b []byte
+		switch t {
+		case "list":
+			b, err = f.client.LPop(ctx, f.name).Bytes()
+			if err == nil {
+				b = append(b, '\n')
+			}
+		case "string":
+			b, err = f.client.GetDel(ctx, f.name).Bytes()
+		}
+		if err != nil && err != redis.Nil {
+			slog.Error("redis command failed", "op", "Read:Pop", "key", f.name, "err", err)
+			return errno(err)
+		}
+		f.invalidate(f.name)
+
+		if b == nil {
+			b = []byte{}
+		}
+		h.rb = b
+	}
+
+	fuseutil.HandleRead(req, resp, h.rb)
+	return nil
+}
+
+// Read serves string keys window by window with GETRANGE so large values
+// are never held in memory. Other types are rendered in full on the first
+// read and served from the handle, like ReadAll would.
+func (h *redisHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) (err error) {
+
+	f := h.f
+	ctx, span := startSpan(ctx, "Read", f.key())
+	defer func() { endSpan(span, err, attribute.Int("rsfs.size", len(resp.Data))) }()
+
+	f.mu.RLock()
+	t := f.t
+	f.mu.RUnlock()
+
+	if f.popOnRead && !f.immutable() && f.pt == "" && (t == "" || t == "string" || t == "list") {
+		return h.readPop(ctx, req, resp)
+	}
+
+	if f.pt == "" && (t == "" || t == "string") {
+		if req.Size == 0 {
+			return nil
+		}
+		if f.coalesce > 0 {
+			// reads through the writing handle see its merged writes
+			h.mu.Lock()
+			err := h.sendPending(ctx)
+			h.mu.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+		if f.touchTTL > 0 && req.Offset == 0 && !f.immutable() {
+			// once per pass rather than per window, never on keys
+			// this mount must not change
+			if err := f.client.Expire(ctx, f.name, f.touchTTL).Err(); err != nil {
+				slog.Error("redis command failed", "op", "Read:Expire", "key", f.name, "err", err)
+				return errno(err)
+			}
+		}
+		b, err := f.client.GetRange(ctx, f.name, req.Offset, req.Offset+int64(req.Size)-1).Bytes()
+		if err != nil {
+			return errno(err)
+		}
+		resp.Data = b
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// a read from the start refreshes the snapshot, like rewinding a dir
+	if h.rb == nil || req.Offset == 0 {
+		f.mu.Lock()
+		b, err := f.reloadFile(ctx)
+		f.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		if b == nil {
+			b = []byte{}
+		}
+		h.rb = b
+	}
+
+	fuseutil.HandleRead(req, resp, h.rb)
+	return nil
+}
+
+// flushHash applies a JSON object written to a hash file: every field is
+// set and fields missing from it are deleted.
+func (f *redisFile) flushHash(ctx context.Context, wb []byte) error {
+
+	values, err := jsonFields(wb)
+	if err != nil {
+		slog.Error("invalid hash file, want a JSON object", "op", "Flush:HSet", "key", f.name, "err", err)
+		return syscall.EINVAL
+	}
+
+	fields, err := f.client.HKeys(ctx, f.name).Result()
+	if err != nil {
+		slog.Error("redis command failed", "op", "Flush:HKeys", "key", f.name, "err", err)
+		return errno(err)
+	}
+	var removed []string
+	for _, k := range fields {
+		if _, ok := values[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+
+	_, err = f.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if len(removed) > 0 {
+			pipe.HDel(ctx, f.name, removed...)
+		}
+		if len(values) > 0 {
+			pipe.HSet(ctx, f.name, values)
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("redis command failed", "op", "Flush:HSet", "key", f.name, "err", err)
+		return errno(err)
+	}
+
+	return nil
+}
+
+func (f *redisFile) flushKey(ctx context.Context, t string, wb []byte) error {
+
+	switch t {
+	case "list":
+		var values []interface{}
+		if f.listFormat == "json" {
+			var elems []string
+			if err := json.Unmarshal(wb, &elems); err != nil {
+				slog.Error("redis command failed", "op", "Flush:RPush", "key", f.name, "err", err)
+				return syscall.EINVAL
+			}
+			for _, e := range elems {
+				values = append(values, e)
+			}
+		} else if len(wb) > 0 {
+			// editors append a final newline, it does not start a new element
+			for _, v := range bytes.Split(bytes.TrimSuffix(wb, []byte{'\n'}), []byte{'\n'}) {
+				values = append(values, v)
+			}
+		}
+
+		_, err := f.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, f.name)
+			if len(values) > 0 {
+				pipe.RPush(ctx, f.name, values...)
+			}
+			return nil
+		})
+		if err != nil {
+			slog.Error("redis command failed", "op", "Flush:RPush", "key", f.name, "err", err)
+			return errno(err)
+		}
+	case "set":
+		var members []interface{}
+		for _, m := range bytes.Split(wb, []byte{'\n'}) {
+			if len(m) == 0 {
+				continue
+			}
+			members = append(members, m)
+		}
+
+		// replace the set atomically so readers never see it empty
+		_, err := f.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, f.name)
+			if len(members) > 0 {
+				pipe.SAdd(ctx, f.name, members...)
+			}
+			return nil
+		})
+		if err != nil {
+			slog.Error("redis command failed", "op", "Flush:SAdd", "key", f.name, "err", err)
+			return errno(err)
+		}
+	case "zset":
+		var members []redis.Z
+		for _, l := range bytes.Split(wb, []byte{'\n'}) {
+			if len(l) == 0 {
+				continue
+			}
+			// members may contain spaces, the score is after the last one
+			i := bytes.LastIndexByte(l, ' ')
+			if i < 0 {
+				slog.Error("invalid zset line, want member and score", "op", "Flush:ZAdd", "key", f.name)
+				return syscall.EIO
+			}
+			score, err := strconv.ParseFloat(string(l[i+1:]), 64)
+			if err != nil {
+				slog.Error("redis command failed", "op", "Flush:ZAdd", "key", f.name, "err", err)
+				return syscall.EIO
+			}
+			members = append(members, redis.Z{
+				Score:  score,
+				Member: l[:i],
+			})
+		}
+
+		_, err := f.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, f.name)
+			if len(members) > 0 {
+				pipe.ZAdd(ctx, f.name, members...)
+			}
+			return nil
+		})
+		if err != nil {
+			slog.Error("redis command failed", "op", "Flush:ZAdd", "key", f.name, "err", err)
+			return errno(err)
+		}
+	case "hash":
+		return f.flushHash(ctx, wb)
+	case rejsonType:
+		if !f.rejson {
+			return syscall.ENOTSUP
+		}
+		return f.setJSON(ctx, f.name, wb)
+	default:
+		// string
+		_, err := f.client.Set(ctx, f.name, wb, 0).Result()
+		if err != nil {
+			slog.Error("redis command failed", "op", "Flush:Set", "key", f.name, "err", err)
+			return errno(err)
+		}
+	}
+
+	return nil
+}
+
+func (f *redisFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if time.Since(f.sizeAt) > f.attrValidity {
+		// first, reading the size resets the idle time
+		if err := f.loadIdle(ctx); err != nil {
+			return err
+		}
+		if err := f.checkExists(ctx); err != nil {
+			return err
+		}
+		if err := f.loadSize(ctx); err != nil {
+			return err
+		}
+		if err := f.loadMeta(ctx); err != nil {
+			return err
+		}
+	}
+
+	// fill fuse.Attr
+	a.Valid = f.attrValidity
+	a.Size = f.size
+	a.Atime = f.atime
+	a.Mtime = f.atime
+	a.Mode = f.fileMode
+	f.applyMeta(a)
+	if f.immutable() {
+		a.Mode &^= 0222
+	}
+	return nil
+}
+
+// checkExists fails with ENOENT once the key or field behind f was deleted
+// or expired by someone else, so stale nodes do not linger until the kernel
+// looks them up again. The caller holds f.mu.
+func (f *redisFile) checkExists(ctx context.Context) error {
+
+	for h := range f.handles {
+		if !h.ro {
+			// created or truncated through a handle and maybe not flushed yet
+			return nil
+		}
+	}
+
+	var ok bool
+	var err error
+	switch f.pt {
+	case "":
+		var n int64
+		n, err = f.client.Exists(ctx, f.name).Result()
+		ok = n > 0
+	case "hash":
+		ok, err = f.client.HExists(ctx, f.parent, f.name).Result()
+	default:
+		// stream entries are checked by their reload
+		return nil
+	}
+	if err != nil {
+		return errno(err)
+	}
+	if !ok {
+		f.invalidate(f.key())
+		return syscall.ENOENT
+	}
+	return nil
+}
+
+// loadSize refreshes f.size, using cheap length commands where the file
+// contents map directly onto a Redis value.
+func (f *redisFile) loadSize(ctx context.Context) error {
+
+	var n int64
+	var err error
+	switch {
+	case f.pt == "hash":
+		n, err = f.client.HStrLen(ctx, f.parent, f.name).Result()
+	case f.pt == "" && (f.t == "" || f.t == "string"):
+		n, err = f.client.StrLen(ctx, f.name).Result()
+	default:
+		// rendered types keep the size of their last render while the
+		// element count is unchanged, handles are DirectIO so a stale
+		// size never cuts reads short
+		if f.rendered.n > 0 && f.rendered.size == f.size {
+			if n, err := f.length(ctx); err == nil && n == f.rendered.n {
+				f.sizeAt = time.Now()
+				return nil
+			}
+		}
+		_, err := f.reloadFile(ctx)
+		return err
+	}
+	if err != nil {
+		return errno(err)
+	}
+
+	f.size = uint64(n)
+	f.sizeAt = time.Now()
+	return nil
+}
+
+// length returns the element count of a rendered key, 0 for other types.
+func (f *redisFile) length(ctx context.Context) (int64, error) {
+	switch f.t {
+	case "list":
+		return f.client.LLen(ctx, f.name).Result()
+	case "set":
+		return f.client.SCard(ctx, f.name).Result()
+	case "zset":
+		return f.client.ZCard(ctx, f.name).Result()
+	case "stream":
+		return f.client.XLen(ctx, f.name).Result()
+	case "hash":
+		return f.client.HLen(ctx, f.name).Result()
+	}
+	return 0, nil
+}
+
+// loadIdle derives the access time from OBJECT IDLETIME, which is the
+// closest thing Redis keeps to a file timestamp.
+func (f *redisFile) loadIdle(ctx context.Context) error {
+
+	idle, err := f.client.ObjectIdleTime(ctx, f.key()).Result()
+	if err != nil {
+		// not written yet, or not tracked under an LFU maxmemory-policy
+		return nil
+	}
+
+	f.atime = time.Now().Add(-idle)
+	return nil
+}
+
+// reloadFile fetches the rendered file contents and refreshes the cached
+// size. The caller must hold f.mu.
+func (f *redisFile) reloadFile(ctx context.Context) (_ []byte, err error) {
+	defer observeOp("reload", &err)
+
+	if f.pt != "" {
+		return f.reloadChild(ctx)
+	}
+
+	if t, b, ok := f.contents.get(f.name); ok {
+		f.t = t
+		f.size = uint64(len(b))
+		f.sizeAt = time.Now()
+		return b, nil
+	}
+
+	t, err := f.keyType(ctx, f.name)
+	if err == redis.Nil || t == "none" {
+		return nil, syscall.ENOENT
+	}
+	if err != nil {
+		return nil, errno(err)
+	}
+
+	var b []byte
+	var n int
+	switch t {
 	case "string":
-		b, err = f.client.Get(f.name).Bytes()
+		// Read serves strings with GETRANGE and applies -touch-ttl there,
+		// this is only reached by keys that turned into strings
+		b, err = f.client.Get(ctx, f.name).Bytes()
 	case "list":
 		var values []string
-		values, err = f.client.LRange(f.name, 0, -1).Result()
+		values, err = f.client.LRange(ctx, f.name, 0, -1).Result()
 		if err != nil {
 			break
 		}
+		n = len(values)
+		if f.listFormat == "json" {
+			b, err = json.Marshal(values)
+			break
+		}
 		for i, _ := range values {
 			b = append(b, []byte(values[i])...)
 			if i != len(values)-1 {
 				b = append(b, '\n')
 			}
 		}
+	case "set":
+		var members []string
+		members, err = f.client.SMembers(ctx, f.name).Result()
+		if err != nil {
+			break
+		}
+		n = len(members)
+		// set order is arbitrary, sort for stable reads
+		sort.Strings(members)
+		for i := range members {
+			b = append(b, []byte(members[i])...)
+			if i != len(members)-1 {
+				b = append(b, '\n')
+			}
+		}
+	case "zset":
+		var members []redis.Z
+		members, err = f.client.ZRangeWithScores(ctx, f.name, 0, -1).Result()
+		if err != nil {
+			break
+		}
+		n = len(members)
+		for i := range members {
+			b = append(b, fmt.Sprint(members[i].Member)...)
+			b = append(b, ' ')
+			b = strconv.AppendFloat(b, members[i].Score, 'f', -1, 64)
+			b = append(b, '\n')
+		}
 	case "stream":
 		var resp []redis.XMessage
-		resp, err = f.client.XRange(f.name, "-", "+").Result()
+		resp, err = f.client.XRange(ctx, f.name, "-", "+").Result()
+		if err != nil {
+			break
+		}
+		n = len(resp)
+		b, err = f.marshalStream(resp)
+	case "hash":
+		var fields map[string]string
+		fields, err = f.client.HGetAll(ctx, f.name).Result()
 		if err != nil {
 			break
 		}
-		b, err = json.Marshal(resp)
+		n = len(fields)
+		// encoding/json sorts the fields, rereads are byte-identical
+		b, err = json.MarshalIndent(fields, "", "  ")
+		b = append(b, '\n')
+	case rejsonType:
+		if !f.rejson {
+			return nil, syscall.ENOTSUP
+		}
+		b, err = f.getJSON(ctx, f.name)
 	default:
-		return syscall.ENOTSUP
+		return nil, syscall.ENOTSUP
 	}
 	if err == redis.Nil {
-		return syscall.ENOENT
+		return nil, syscall.ENOENT
 	}
 	if err != nil {
-		return syscall.EIO
+		return nil, errno(err)
 	}
 
-	f.rb = b
+	f.t = t
 	f.size = uint64(len(b))
+	f.sizeAt = time.Now()
+	f.rendered.size, f.rendered.n = f.size, int64(n)
+	f.contents.set(f.name, t, b)
 
-	return nil
+	return b, nil
 }
 
-func (f *redisFile) ReadAll(ctx context.Context) ([]byte, error) {
+// streamValues turns a written entry into stream fields. A JSON object maps
+// each key to a field, anything else is stored whole under "blob".
+func streamValues(b []byte) map[string]interface{} {
+	values, err := jsonFields(b)
+	if err != nil || len(values) == 0 {
+		return map[string]interface{}{"blob": b}
+	}
+	return values
+}
+
+// binaryKey wraps field values that are not valid UTF-8, which JSON strings
+// cannot carry, as {"base64": "<standard encoding>"} in rendered streams.
+const binaryKey = "base64"
+
+// binarySafe returns m with every value that is not valid UTF-8 wrapped
+// under binaryKey.
+func binarySafe(m redis.XMessage) redis.XMessage {
+	var values map[string]interface{}
+	for k, v := range m.Values {
+		s, ok := v.(string)
+		if !ok || utf8.ValidString(s) {
+			continue
+		}
+		if values == nil {
+			values = maps.Clone(m.Values)
+		}
+		values[k] = map[string]string{binaryKey: base64.StdEncoding.EncodeToString([]byte(s))}
+	}
+	if values != nil {
+		m.Values = values
+	}
+	return m
+}
+
+// jsonFields decodes a JSON object into field values. Strings are stored
+// as-is, objects holding only binaryKey as the bytes they encode, numbers,
+// bools and other nested values keep their JSON text.
+func jsonFields(b []byte) (map[string]interface{}, error) {
 
-	if err := f.reloadFile(ctx); err != nil {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(b, &obj); err != nil {
 		return nil, err
 	}
+	if obj == nil {
+		return nil, errors.New("not a JSON object")
+	}
+
+	values := make(map[string]interface{}, len(obj))
+	for k, raw := range obj {
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			values[k] = s
+			continue
+		}
+		var bin map[string]string
+		if err := json.Unmarshal(raw, &bin); err == nil && len(bin) == 1 {
+			if enc, ok := bin[binaryKey]; ok {
+				if d, err := base64.StdEncoding.DecodeString(enc); err == nil {
+					values[k] = d
+					continue
+				}
+			}
+		}
+		values[k] = string(raw)
+	}
+	return values, nil
+}
+
+// marshalStream renders stream messages in the configured -stream-format.
+// Values are maps, which encoding/json writes with sorted keys, so repeated
+// reads of an unchanged stream are byte-identical.
+func (rfs *redisFS) marshalStream(v interface{}) ([]byte, error) {
+
+	switch m := v.(type) {
+	case redis.XMessage:
+		v = binarySafe(m)
+	case []redis.XMessage:
+		msgs := make([]redis.XMessage, len(m))
+		for i := range m {
+			msgs[i] = binarySafe(m[i])
+		}
+		v = msgs
+	}
+
+	switch rfs.streamFormat {
+	case "json-pretty":
+		return json.MarshalIndent(v, "", "  ")
+	case "ndjson":
+		msgs, ok := v.([]redis.XMessage)
+		if !ok {
+			return json.Marshal(v)
+		}
+		var b []byte
+		for i := range msgs {
+			m, err := json.Marshal(msgs[i])
+			if err != nil {
+				return nil, err
+			}
+			b = append(b, m...)
+			b = append(b, '\n')
+		}
+		return b, nil
+	default:
+		return json.Marshal(v)
+	}
+}
+
+// reloadChild loads a file living inside a hash, stream or list directory.
+func (f *redisFile) reloadChild(ctx context.Context) ([]byte, error) {
+
+	var b []byte
+	var err error
+	switch f.pt {
+	case "hash":
+		b, err = f.client.HGet(ctx, f.parent, f.name).Bytes()
+	case "stream":
+		var resp []redis.XMessage
+		resp, err = f.client.XRange(ctx, f.parent, f.name, f.name).Result()
+		if err != nil {
+			break
+		}
+		if len(resp) == 0 {
+			return nil, syscall.ENOENT
+		}
+		b, err = f.marshalStream(resp[0])
+	case "list":
+		i, _ := listIndex(f.name)
+		b, err = f.client.LIndex(ctx, f.parent, i).Bytes()
+	default:
+		return nil, syscall.ENOTSUP
+	}
+	if err == redis.Nil {
+		return nil, syscall.ENOENT
+	}
+	if err != nil {
+		return nil, errno(err)
+	}
+
+	f.size = uint64(len(b))
+	f.sizeAt = time.Now()
 
-	return f.rb, nil
+	return b, nil
 }
@@ -0,0 +1,1115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestFS returns a redisFS with the flag defaults, backed by a fresh
+// miniredis.
+func newTestFS(t testing.TB) (*redisFS, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	client, err := newRedisClient(&redis.UniversalOptions{Addrs: []string{mr.Addr()}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	rfs := &redisFS{
+		client:       client,
+		attrValidity: time.Minute,
+		scanCount:    1000,
+		types:        newTypeCache(time.Minute),
+		contents:     newContentCache(32<<20, time.Minute),
+		listFormat:   "lines",
+		streamFormat: "json",
+		fileMode:     0644,
+		dirMode:      0555,
+		maxWriteBuf:  512 << 20,
+		writeThrough: 8 << 20,
+		listPush:     "right",
+		hashFormat:   "dir",
+	}
+	return rfs, mr
+}
+
+func rootDir(t testing.TB, rfs *redisFS) *redisDir {
+	t.Helper()
+	n, err := rfs.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n.(*redisDir)
+}
+
+func lookup(t *testing.T, d *redisDir, name string) fs.Node {
+	t.Helper()
+	n, err := d.Lookup(context.Background(), name)
+	if err != nil {
+		t.Fatalf("Lookup(%q): %v", name, err)
+	}
+	return n
+}
+
+func lookupFile(t *testing.T, d *redisDir, name string) *redisFile {
+	t.Helper()
+	f, ok := lookup(t, d, name).(*redisFile)
+	if !ok {
+		t.Fatalf("Lookup(%q) is not a file", name)
+	}
+	return f
+}
+
+func open(t *testing.T, f *redisFile, flags fuse.OpenFlags) *redisHandle {
+	t.Helper()
+	h, err := f.Open(context.Background(), &fuse.OpenRequest{Flags: flags}, &fuse.OpenResponse{})
+	if err != nil {
+		t.Fatalf("Open(%q): %v", f.name, err)
+	}
+	return h.(*redisHandle)
+}
+
+// readAll reads h to EOF in windows of size bytes.
+func readAll(t *testing.T, h *redisHandle, size int) string {
+	t.Helper()
+	var b []byte
+	for {
+		// the kernel connection hands Read a buffer of the request size
+		resp := &fuse.ReadResponse{Data: make([]byte, 0, size)}
+		err := h.Read(context.Background(), &fuse.ReadRequest{Offset: int64(len(b)), Size: size}, resp)
+		if err != nil {
+			t.Fatalf("Read(%q): %v", h.f.name, err)
+		}
+		b = append(b, resp.Data...)
+		if len(resp.Data) < size {
+			return string(b)
+		}
+	}
+}
+
+func write(t testing.TB, h *redisHandle, off int64, data string) {
+	t.Helper()
+	resp := &fuse.WriteResponse{}
+	if err := h.Write(context.Background(), &fuse.WriteRequest{Offset: off, Data: []byte(data)}, resp); err != nil {
+		t.Fatalf("Write(%q): %v", h.f.name, err)
+	}
+	if resp.Size != len(data) {
+		t.Fatalf("Write(%q) wrote %d of %d bytes", h.f.name, resp.Size, len(data))
+	}
+}
+
+func closeHandle(t testing.TB, h *redisHandle) {
+	t.Helper()
+	if err := h.Flush(context.Background(), &fuse.FlushRequest{}); err != nil {
+		t.Fatalf("Flush(%q): %v", h.f.name, err)
+	}
+	h.Release(context.Background(), &fuse.ReleaseRequest{})
+}
+
+// readFile reads the whole file through a fresh read-only handle.
+func readFile(t *testing.T, f *redisFile) string {
+	t.Helper()
+	h := open(t, f, fuse.OpenReadOnly)
+	defer closeHandle(t, h)
+	return readAll(t, h, 128<<10)
+}
+
+func TestStreamLookup(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	mr.XAdd("s", "5-1", []string{"a", "1"})
+	d := lookup(t, rootDir(t, rfs), "s").(*redisDir)
+
+	if got := readFile(t, lookupFile(t, d, "5-1")); got != `{"ID":"5-1","Values":{"a":"1"},"MillisElapsedFromDelivery":0,"DeliveredCount":0}` {
+		t.Fatalf("entry 5-1 = %s", got)
+	}
+	for _, name := range []string{".git", "foo", "5-x", "6-0"} {
+		if _, err := d.Lookup(context.Background(), name); err != syscall.ENOENT {
+			t.Errorf("Lookup(%q) = %v, want ENOENT", name, err)
+		}
+	}
+}
+
+func createFile(t testing.TB, d *redisDir, name string) (*redisFile, *redisHandle) {
+	t.Helper()
+	n, h, err := d.Create(context.Background(), &fuse.CreateRequest{Name: name, Flags: fuse.OpenWriteOnly}, &fuse.CreateResponse{})
+	if err != nil {
+		t.Fatalf("Create(%q): %v", name, err)
+	}
+	return n.(*redisFile), h.(*redisHandle)
+}
+
+func TestStreamCreate(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	mr.XAdd("s", "5-1", []string{"a", "1"})
+	d := lookup(t, rootDir(t, rfs), "s").(*redisDir)
+
+	// open(O_CREAT) looks the name up first, which must not fail with EIO
+	for _, name := range []string{"*", "7-*"} {
+		if _, err := d.Lookup(context.Background(), name); err != syscall.ENOENT {
+			t.Fatalf("Lookup(%q) = %v, want ENOENT", name, err)
+		}
+	}
+
+	f, h := createFile(t, d, "9-2")
+	write(t, h, 0, `{"b":"2"}`)
+	closeHandle(t, h)
+
+	f, h = createFile(t, d, "*")
+	write(t, h, 0, `{"c":"3"}`)
+	closeHandle(t, h)
+
+	msgs, err := rfs.client.XRange(context.Background(), "s", "-", "+").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 3 || msgs[1].ID != "9-2" || msgs[1].Values["b"] != "2" || msgs[2].Values["c"] != "3" {
+		t.Fatalf("stream = %v", msgs)
+	}
+
+	resp := &fuse.GetxattrResponse{}
+	if err := f.Getxattr(context.Background(), &fuse.GetxattrRequest{Name: xattrStreamID}, resp); err != nil {
+		t.Fatal(err)
+	}
+	if string(resp.Xattr) != msgs[2].ID {
+		t.Fatalf("auto ID = %s, want %s", resp.Xattr, msgs[2].ID)
+	}
+}
+
+func truncate(t *testing.T, f *redisFile, size uint64) error {
+	t.Helper()
+	return f.Setattr(context.Background(), &fuse.SetattrRequest{Valid: fuse.SetattrSize, Size: size}, &fuse.SetattrResponse{})
+}
+
+func TestTruncateWithoutHandles(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	root := rootDir(t, rfs)
+	mr.Set("s", "hello")
+	mr.HSet("h", "f", "value")
+	mr.RPush("l", "a", "b")
+
+	f := lookupFile(t, root, "s")
+	for _, c := range []struct {
+		size uint64
+		want string
+	}{{2, "he"}, {4, "he\x00\x00"}, {0, ""}} {
+		if err := truncate(t, f, c.size); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := mr.Get("s"); got != c.want {
+			t.Fatalf("after truncate to %d: %q, want %q", c.size, got, c.want)
+		}
+		var a fuse.Attr
+		if err := f.Attr(context.Background(), &a); err != nil || a.Size != c.size {
+			t.Fatalf("size after truncate to %d: %d, %v", c.size, a.Size, err)
+		}
+	}
+
+	field := lookupFile(t, lookup(t, root, "h").(*redisDir), "f")
+	if err := truncate(t, field, 3); err != nil {
+		t.Fatal(err)
+	}
+	if got := mr.HGet("h", "f"); got != "val" {
+		t.Fatalf("field after truncate = %q", got)
+	}
+
+	l := lookupFile(t, root, "l")
+	readFile(t, l)
+	if err := truncate(t, l, 1); err != syscall.ENOTSUP {
+		t.Fatalf("partial list truncate = %v, want ENOTSUP", err)
+	}
+	if err := truncate(t, l, 0); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists("l") {
+		t.Fatal("list survived truncate to 0")
+	}
+}
+
+// openTrunc opens f like open(O_WRONLY|O_TRUNC) does without atomic
+// O_TRUNC: an open followed by a truncate through the new handle.
+func openTrunc(t *testing.T, f *redisFile) (*redisHandle, error) {
+	t.Helper()
+	const pid = 4242
+	req := &fuse.OpenRequest{Header: fuse.Header{Pid: pid}, Flags: fuse.OpenWriteOnly}
+	h, err := f.Open(context.Background(), req, &fuse.OpenResponse{})
+	if err != nil {
+		t.Fatalf("Open(%q): %v", f.name, err)
+	}
+	return h.(*redisHandle), f.Setattr(context.Background(), &fuse.SetattrRequest{
+		Header: fuse.Header{Pid: pid},
+		Valid:  fuse.SetattrSize | fuse.SetattrHandle,
+	}, &fuse.SetattrResponse{})
+}
+
+func TestTruncateKeepsRenderedKeys(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	rfs.typeSuffix = true
+	rfs.hashFormat = "json"
+	mr.ZAdd("z", 1, "a")
+	mr.HSet("h", "f", "v")
+	mr.RPush("l", "a", "b")
+	root := rootDir(t, rfs)
+
+	for _, c := range []struct {
+		name, data string
+		want       error
+	}{
+		{"z.zset", "bad\n", syscall.EIO},
+		{"h.json", "{not json", syscall.EINVAL},
+	} {
+		h, err := openTrunc(t, lookupFile(t, root, c.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		write(t, h, 0, c.data)
+		if err := h.Flush(context.Background(), &fuse.FlushRequest{}); err != c.want {
+			t.Fatalf("%s: flush = %v, want %v", c.name, err, c.want)
+		}
+		h.Release(context.Background(), &fuse.ReleaseRequest{})
+	}
+	if members, err := mr.ZMembers("z"); err != nil || !slices.Equal(members, []string{"a"}) {
+		t.Fatalf("z = %q, %v after a failed write", members, err)
+	}
+	if v := mr.HGet("h", "f"); v != "v" {
+		t.Fatalf("h.f = %q after a failed write", v)
+	}
+
+	// an emptied file replaces the key on close
+	h, err := openTrunc(t, lookupFile(t, root, "l.list"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mr.Exists("l") {
+		t.Fatal("O_TRUNC deleted l before any write")
+	}
+	write(t, h, 0, "c\n")
+	closeHandle(t, h)
+	if l, _ := mr.List("l"); !slices.Equal(l, []string{"c"}) {
+		t.Fatalf("l = %q", l)
+	}
+}
+
+func TestTruncateLeavesCleanHandles(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	mr.Set("k", "old")
+	f := lookupFile(t, rootDir(t, rfs), "k")
+
+	a := open(t, f, fuse.OpenReadWrite)
+	b := open(t, f, fuse.OpenWriteOnly)
+	if err := truncate(t, f, 0); err != nil {
+		t.Fatal(err)
+	}
+	write(t, b, 0, "new")
+	closeHandle(t, b)
+	closeHandle(t, a)
+
+	if got, _ := mr.Get("k"); got != "new" {
+		t.Fatalf("k = %q, want the write of the truncating handle", got)
+	}
+}
+
+func TestFsync(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	f, h := createFile(t, rootDir(t, rfs), "k")
+	write(t, h, 0, "data")
+
+	if err := f.Fsync(context.Background(), &fuse.FsyncRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := mr.Get("k"); err != nil || got != "data" {
+		t.Fatalf("k after fsync = %q, %v", got, err)
+	}
+	closeHandle(t, h)
+}
+
+func TestAttrIdleTime(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	mr.Set("k", "v")
+	f := lookupFile(t, rootDir(t, rfs), "k")
+
+	now := time.Now()
+	mr.SetTime(now.Add(-time.Hour))
+	mr.Set("k", "value")
+	mr.SetTime(now)
+
+	var a fuse.Attr
+	if err := f.Attr(context.Background(), &a); err != nil {
+		t.Fatal(err)
+	}
+	if d := now.Add(-time.Hour).Sub(a.Atime); d < -time.Minute || d > time.Minute {
+		t.Fatalf("atime = %v, want about an hour ago", a.Atime)
+	}
+	if a.Size != 5 {
+		t.Fatalf("size = %d", a.Size)
+	}
+}
+
+func TestMkdir(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	root := rootDir(t, rfs)
+	ctx := context.Background()
+
+	n, err := root.Mkdir(ctx, &fuse.MkdirRequest{Name: "events"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ, _ := rfs.client.Type(ctx, "events").Result(); typ != "stream" {
+		t.Fatalf("events is a %q", typ)
+	}
+	if groups, _ := rfs.client.XInfoGroups(ctx, "events").Result(); len(groups) != 0 {
+		t.Fatalf("leftover groups %v", groups)
+	}
+	if _, err := n.(*redisDir).Mkdir(ctx, &fuse.MkdirRequest{Name: "x"}); err != syscall.EPERM {
+		t.Fatalf("mkdir inside a stream = %v, want EPERM", err)
+	}
+
+	if _, err := root.Mkdir(ctx, &fuse.MkdirRequest{Name: "events"}); err != syscall.EEXIST {
+		t.Fatalf("mkdir existing = %v, want EEXIST", err)
+	}
+
+	mr.HSet("h", "f", "v")
+	h := lookup(t, root, "h").(*redisDir)
+	if _, err := h.Mkdir(ctx, &fuse.MkdirRequest{Name: "foo"}); err != syscall.EPERM {
+		t.Fatalf("mkdir inside a hash = %v, want EPERM", err)
+	}
+	if mr.Exists("foo") {
+		t.Fatal("mkdir inside a hash created a top-level key")
+	}
+}
+
+func TestMkdirReadonlyKeys(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	rfs.readonlyKeys = []string{"config:*"}
+	root := rootDir(t, rfs)
+
+	if _, err := root.Mkdir(context.Background(), &fuse.MkdirRequest{Name: "config:s"}); err != syscall.EROFS {
+		t.Fatalf("mkdir protected = %v, want EROFS", err)
+	}
+	if mr.Exists("config:s") {
+		t.Fatal("protected stream was created")
+	}
+}
+
+func TestBinarySafeRoundTrip(t *testing.T) {
+	values := map[string]interface{}{
+		"text": "héllo",
+		"nul":  "a\x00b",
+		"bin":  "\xff\xfe\x00\x01",
+	}
+
+	b, err := json.Marshal(binarySafe(redis.XMessage{ID: "1-1", Values: values}).Values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := jsonFields(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for k, v := range values {
+		var s string
+		switch g := got[k].(type) {
+		case string:
+			s = g
+		case []byte:
+			s = string(g)
+		default:
+			t.Fatalf("%s decoded as %T", k, got[k])
+		}
+		if s != v {
+			t.Fatalf("%s = %q, want %q", k, s, v)
+		}
+	}
+}
+
+func TestRename(t *testing.T) {
+	for _, noClobber := range []bool{false, true} {
+		rfs, mr := newTestFS(t)
+		rfs.noClobber = noClobber
+		mr.Set("a", "1")
+		mr.Set("b", "2")
+		mr.HSet("h", "x", "1")
+		mr.HSet("h", "y", "2")
+		root := rootDir(t, rfs)
+		h := lookup(t, root, "h").(*redisDir)
+		ctx := context.Background()
+
+		errKey := root.Rename(ctx, &fuse.RenameRequest{OldName: "a", NewName: "b"}, root)
+		errField := h.Rename(ctx, &fuse.RenameRequest{OldName: "x", NewName: "y"}, h)
+		if noClobber {
+			if errKey != syscall.EEXIST || errField != syscall.EEXIST {
+				t.Fatalf("no-clobber renames = %v, %v, want EEXIST", errKey, errField)
+			}
+			if v, _ := mr.Get("b"); v != "2" || !mr.Exists("a") {
+				t.Fatalf("no-clobber key rename changed b to %q", v)
+			}
+			if v := mr.HGet("h", "y"); v != "2" || mr.HGet("h", "x") != "1" {
+				t.Fatalf("no-clobber field rename changed y to %q", v)
+			}
+		} else {
+			if errKey != nil || errField != nil {
+				t.Fatalf("renames = %v, %v", errKey, errField)
+			}
+			if v, _ := mr.Get("b"); v != "1" || mr.Exists("a") {
+				t.Fatalf("key rename left b = %q", v)
+			}
+			if v := mr.HGet("h", "y"); v != "1" || mr.HGet("h", "x") != "" {
+				t.Fatalf("field rename left y = %q", v)
+			}
+		}
+
+		if err := h.Rename(ctx, &fuse.RenameRequest{OldName: "y", NewName: "z"}, h); err != nil {
+			t.Fatal(err)
+		}
+		if mr.HGet("h", "z") == "" || mr.HGet("h", "y") != "" {
+			t.Fatal("rename to a new field did not move it")
+		}
+		if err := h.Rename(ctx, &fuse.RenameRequest{OldName: "missing", NewName: "w"}, h); err != syscall.ENOENT {
+			t.Fatalf("rename of a missing field = %v, want ENOENT", err)
+		}
+	}
+}
+
+func TestLoadSizeRendered(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	mr.RPush("l", "a", "bb", "ccc")
+	f := lookupFile(t, rootDir(t, rfs), "l")
+	ctx := context.Background()
+
+	loadSize := func() uint64 {
+		t.Helper()
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if err := f.loadSize(ctx); err != nil {
+			t.Fatal(err)
+		}
+		return f.size
+	}
+
+	if got := loadSize(); got != 8 {
+		t.Fatalf("size = %d, want 8", got)
+	}
+	before := mr.CommandCount()
+	if got := loadSize(); got != 8 {
+		t.Fatalf("size = %d, want 8", got)
+	}
+	if n := mr.CommandCount() - before; n != 1 {
+		t.Fatalf("unchanged list took %d commands, want a single LLEN", n)
+	}
+
+	rfs.contents.invalidate("l")
+	mr.RPush("l", "dddd")
+	if got := loadSize(); got != 13 {
+		t.Fatalf("size after RPUSH = %d, want 13", got)
+	}
+}
+
+func TestTouchTTL(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	rfs.touchTTL = time.Hour
+	mr.Set("k", "value")
+	mr.SetTTL("k", time.Minute)
+
+	f := lookupFile(t, rootDir(t, rfs), "k")
+	if got := readFile(t, f); got != "value" {
+		t.Fatalf("read %q", got)
+	}
+	if ttl := mr.TTL("k"); ttl != time.Hour {
+		t.Fatalf("TTL after read = %v, want %v", ttl, time.Hour)
+	}
+
+	rfs.readonlyKeys = []string{"config:*"}
+	mr.Set("config:k", "value")
+	mr.SetTTL("config:k", time.Minute)
+	readFile(t, lookupFile(t, rootDir(t, rfs), "config:k"))
+	rfs.readonlyKeys = nil
+	rfs.readOnly = true
+	mr.SetTTL("k", time.Minute)
+	readFile(t, f)
+	for _, k := range []string{"config:k", "k"} {
+		if ttl := mr.TTL(k); ttl != time.Minute {
+			t.Fatalf("TTL of %s after a read it may not change = %v", k, ttl)
+		}
+	}
+}
+
+func TestWriteOffsets(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	_, h := createFile(t, rootDir(t, rfs), "f")
+	write(t, h, 0, "abc")
+	write(t, h, 100, "xyz")
+	closeHandle(t, h)
+
+	want := "abc" + strings.Repeat("\x00", 97) + "xyz"
+	if got, _ := mr.Get("f"); got != want {
+		t.Fatalf("f = %q, want %q", got, want)
+	}
+}
+
+// cmdLog is a client hook recording the names of the commands sent.
+type cmdLog struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (l *cmdLog) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (l *cmdLog) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		l.mu.Lock()
+		l.names = append(l.names, cmd.Name())
+		l.mu.Unlock()
+		return next(ctx, cmd)
+	}
+}
+
+func (l *cmdLog) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		l.mu.Lock()
+		for _, cmd := range cmds {
+			l.names = append(l.names, cmd.Name())
+		}
+		l.mu.Unlock()
+		return next(ctx, cmds)
+	}
+}
+
+func TestReadOnlyOpenSendsNoWrite(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	mr.Set("k", "value")
+	f := lookupFile(t, rootDir(t, rfs), "k")
+
+	log := &cmdLog{}
+	rfs.client.AddHook(log)
+
+	h := open(t, f, fuse.OpenReadOnly)
+	if got := readAll(t, h, 4096); got != "value" {
+		t.Fatalf("read %q", got)
+	}
+	closeHandle(t, h)
+
+	for _, name := range log.names {
+		switch name {
+		case "set", "setrange", "append", "del", "unlink", "expire", "multi":
+			t.Fatalf("read-only open sent %s, commands %v", name, log.names)
+		}
+	}
+	if len(log.names) == 0 {
+		t.Fatal("no commands recorded")
+	}
+}
+
+func TestConcurrentHandles(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	mr.Set("k", "")
+	f := lookupFile(t, rootDir(t, rfs), "k")
+	ctx := context.Background()
+
+	// both write before either flushes, then flush first a, then b
+	var wrote sync.WaitGroup
+	wrote.Add(2)
+	aFlushed := make(chan struct{})
+	errs := make(chan error, 2)
+	run := func(data string, before, after chan struct{}) (err error) {
+		if after != nil {
+			defer close(after)
+		}
+		h, err := f.Open(ctx, &fuse.OpenRequest{Flags: fuse.OpenWriteOnly}, &fuse.OpenResponse{})
+		if err != nil {
+			wrote.Done()
+			return err
+		}
+		defer h.(*redisHandle).Release(ctx, &fuse.ReleaseRequest{})
+		err = h.(*redisHandle).Write(ctx, &fuse.WriteRequest{Data: []byte(data)}, &fuse.WriteResponse{})
+		wrote.Done()
+		if err != nil {
+			return err
+		}
+		wrote.Wait()
+		if before != nil {
+			<-before
+		}
+		return h.(*redisHandle).Flush(ctx, &fuse.FlushRequest{})
+	}
+	go func() { errs <- run("first writer", nil, aFlushed) }()
+	go func() { errs <- run("second", aFlushed, nil) }()
+
+	for range 2 {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, _ := mr.Get("k"); got != "second" {
+		t.Fatalf("k = %q, want the last flush", got)
+	}
+}
+
+func TestGenerateInode(t *testing.T) {
+	rfs, _ := newTestFS(t)
+	if a, b := rfs.GenerateInode(1, "x"), rfs.GenerateInode(2, "x"); a == b {
+		t.Fatalf("x has inode %d under both parents", a)
+	}
+	if a, b := rfs.GenerateInode(1, "x"), rfs.GenerateInode(1, "x"); a != b {
+		t.Fatalf("inode of x changed from %d to %d", a, b)
+	}
+}
+
+func TestClusterListing(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	// miniredis answers CLUSTER SLOTS as a single master owning every slot
+	client, err := newRedisClient(&redis.UniversalOptions{Addrs: []string{mr.Addr()}}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	if _, ok := client.(*redis.ClusterClient); !ok {
+		t.Fatalf("client is a %T", client)
+	}
+	rfs.client = client
+
+	for _, k := range []string{"c", "a", "b"} {
+		mr.Set(k, k)
+	}
+	keys, err := rfs.scanKeys(context.Background(), "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a", "b", "c"}
+	if !slices.Equal(keys, want) {
+		t.Fatalf("keys = %q, want %q", keys, want)
+	}
+	got := slices.DeleteFunc(dirNames(t, rootDir(t, rfs)), func(name string) bool {
+		return strings.HasPrefix(name, ".")
+	})
+	if !slices.Equal(got, want) {
+		t.Fatalf("root = %q, want %q", got, want)
+	}
+}
+
+func TestReadLargeString(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	b := make([]byte, 50<<20)
+	rand.New(rand.NewSource(1)).Read(b)
+	mr.Set("big", string(b))
+
+	h := open(t, lookupFile(t, rootDir(t, rfs), "big"), fuse.OpenReadOnly)
+	defer closeHandle(t, h)
+	if got := readAll(t, h, 128<<10); got != string(b) {
+		t.Fatalf("read %d bytes that differ from the %d stored", len(got), len(b))
+	}
+}
+
+func TestKeyNameRoundTrip(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	rfs.escapeKeys = true
+
+	for _, key := range []string{"a/b", "line\nbreak", "nul\x00byte", "100%", "%2F", "plain"} {
+		name := rfs.displayName(key)
+		if strings.ContainsAny(name, "/\x00\n") {
+			t.Errorf("displayName(%q) = %q is not a valid file name", key, name)
+		}
+		if got := rfs.keyName(name); got != key {
+			t.Errorf("keyName(displayName(%q)) = %q", key, got)
+		}
+
+		mr.Set(key, "v")
+		if got := readFile(t, lookupFile(t, rootDir(t, rfs), name)); got != "v" {
+			t.Errorf("%q reads %q", name, got)
+		}
+	}
+}
+
+func TestStreamMaxLen(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	rfs.streamMaxLen = 3
+	// miniredis rejects the "=" go-redis sends for exact trimming and
+	// trims "~" exactly, where real Redis may keep a few more
+	rfs.streamApprox = true
+	mr.XAdd("s", "1-1", []string{"n", "0"})
+	d := lookup(t, rootDir(t, rfs), "s").(*redisDir)
+
+	for i := 1; i <= 3; i++ {
+		_, h := createFile(t, d, "*")
+		write(t, h, 0, fmt.Sprintf(`{"n":"%d"}`, i))
+		closeHandle(t, h)
+	}
+
+	msgs, err := rfs.client.XRange(context.Background(), "s", "-", "+").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 3 || msgs[0].Values["n"] != "1" || msgs[2].Values["n"] != "3" {
+		t.Fatalf("stream = %v, want the newest 3 entries", msgs)
+	}
+}
+
+func TestAppend(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	mr.Set("k", "start")
+	f := lookupFile(t, rootDir(t, rfs), "k")
+
+	h := open(t, f, fuse.OpenWriteOnly|fuse.OpenAppend)
+	write(t, h, 5, "ab")
+	write(t, h, 7, "cd")
+	closeHandle(t, h)
+
+	h = open(t, f, fuse.OpenWriteOnly|fuse.OpenAppend)
+	write(t, h, 9, "ef")
+	closeHandle(t, h)
+
+	if got, _ := mr.Get("k"); got != "startabcdef" {
+		t.Fatalf("k = %q, want the chunks appended in order", got)
+	}
+}
+
+func TestCreateList(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	rfs.typeSuffix = true
+	root := rootDir(t, rfs)
+
+	// lists render without a trailing newline, one written is dropped
+	// rather than turned into an empty element
+	for _, data := range []string{"a\nb\nc", "a\nb\nc\n"} {
+		mr.Del("x")
+		_, h := createFile(t, root, "x.list")
+		write(t, h, 0, data)
+		closeHandle(t, h)
+
+		if l, err := mr.List("x"); err != nil || !slices.Equal(l, []string{"a", "b", "c"}) {
+			t.Fatalf("writing %q gave x = %q, %v", data, l, err)
+		}
+		if got := readFile(t, lookupFile(t, root, "x.list")); got != "a\nb\nc" {
+			t.Fatalf("x.list reads %q", got)
+		}
+	}
+}
+
+func TestListPushPop(t *testing.T) {
+	for push, want := range map[string][]string{
+		"right": {"zero", "one", "two", "three"},
+		"left":  {"three", "two", "one", "zero"},
+	} {
+		rfs, mr := newTestFS(t)
+		rfs.listPush = push
+		rfs.popOnRead = true
+		mr.RPush("q", "zero")
+		f := lookupFile(t, rootDir(t, rfs), "q")
+
+		h := open(t, f, fuse.OpenWriteOnly|fuse.OpenAppend)
+		write(t, h, 4, "one\ntwo\nthree\n")
+		closeHandle(t, h)
+
+		for _, w := range want {
+			if got := readFile(t, f); got != w+"\n" {
+				t.Fatalf("-list-push %s: popped %q, want %q", push, got, w)
+			}
+		}
+		if mr.Exists("q") {
+			t.Fatalf("-list-push %s: q left after popping every element", push)
+		}
+	}
+}
+
+// BenchmarkWriteLarge writes a 200MB string in 128KB writes, as the kernel
+// sends them, buffered until close and sent as it is written. miniredis
+// copies the whole value on every SETRANGE, which Redis does not, so the
+// uncoalesced case is far slower here than against a server.
+func BenchmarkWriteLarge(b *testing.B) {
+	const size, chunk = 200 << 20, 128 << 10
+	data := make([]byte, chunk)
+
+	for _, bc := range []struct {
+		name         string
+		writeThrough int64
+		coalesce     time.Duration
+	}{
+		{"buffered", 0, 0},
+		{"setrange", 8 << 20, 0},
+		{"setrange-coalesced", 8 << 20, time.Minute},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			rfs, _ := newTestFS(b)
+			rfs.writeThrough = bc.writeThrough
+			rfs.coalesce = bc.coalesce
+			root := rootDir(b, rfs)
+			b.SetBytes(size)
+			for i := 0; i < b.N; i++ {
+				_, h := createFile(b, root, fmt.Sprintf("big%d", i))
+				for off := 0; off < size; off += chunk {
+					write(b, h, int64(off), string(data))
+				}
+				closeHandle(b, h)
+			}
+		})
+	}
+}
+
+// beforePipeline is a client hook running fn ahead of every pipeline and
+// transaction, failing them with its error.
+type beforePipeline struct {
+	fn func() error
+}
+
+func (b *beforePipeline) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (b *beforePipeline) ProcessHook(next redis.ProcessHook) redis.ProcessHook { return next }
+
+func (b *beforePipeline) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if err := b.fn(); err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+		return next(ctx, cmds)
+	}
+}
+
+func TestMkdirFailure(t *testing.T) {
+	ctx := context.Background()
+
+	// the MULTI never reaches Redis
+	rfs, mr := newTestFS(t)
+	root := rootDir(t, rfs)
+	rfs.client.AddHook(&beforePipeline{fn: func() error { return errors.New("connection reset") }})
+	if _, err := root.Mkdir(ctx, &fuse.MkdirRequest{Name: "s"}); err != syscall.EIO {
+		t.Fatalf("mkdir = %v, want EIO", err)
+	}
+	if mr.Exists("s") {
+		t.Fatal("failed mkdir left a key")
+	}
+
+	// another client creates a string between EXISTS and the MULTI
+	rfs, mr = newTestFS(t)
+	root = rootDir(t, rfs)
+	rfs.client.AddHook(&beforePipeline{fn: func() error { return mr.Set("s", "v") }})
+	if _, err := root.Mkdir(ctx, &fuse.MkdirRequest{Name: "s"}); err != syscall.EEXIST {
+		t.Fatalf("mkdir = %v, want EEXIST", err)
+	}
+	if v, _ := mr.Get("s"); v != "v" {
+		t.Fatalf("s = %q, want the concurrent string", v)
+	}
+
+	// or a stream, which the MULTI adopts without leaving its group
+	rfs, mr = newTestFS(t)
+	root = rootDir(t, rfs)
+	rfs.client.AddHook(&beforePipeline{fn: func() error {
+		_, err := mr.XAdd("s", "1-1", []string{"a", "1"})
+		return err
+	}})
+	if _, err := root.Mkdir(ctx, &fuse.MkdirRequest{Name: "s"}); err != nil {
+		t.Fatal(err)
+	}
+	if groups, err := rfs.client.XInfoGroups(ctx, "s").Result(); err != nil || len(groups) != 0 {
+		t.Fatalf("groups = %v, %v", groups, err)
+	}
+	if n, _ := rfs.client.XLen(ctx, "s").Result(); n != 1 {
+		t.Fatalf("stream has %d entries, want the concurrent one", n)
+	}
+}
+
+func TestPartialOverwrite(t *testing.T) {
+	for _, writeThrough := range []int64{8 << 20, 4} {
+		rfs, mr := newTestFS(t)
+		rfs.writeThrough = writeThrough
+		mr.Set("k", "hello world")
+		mr.HSet("h", "f", "hello world")
+		root := rootDir(t, rfs)
+
+		for _, f := range []*redisFile{
+			lookupFile(t, root, "k"),
+			lookupFile(t, lookup(t, root, "h").(*redisDir), "f"),
+		} {
+			h := open(t, f, fuse.OpenWriteOnly)
+			write(t, h, 6, "WORLD")
+			closeHandle(t, h)
+		}
+
+		if got, _ := mr.Get("k"); got != "hello WORLD" {
+			t.Fatalf("-write-through-size %d: k = %q", writeThrough, got)
+		}
+		if got := mr.HGet("h", "f"); got != "hello WORLD" {
+			t.Fatalf("-write-through-size %d: h.f = %q", writeThrough, got)
+		}
+	}
+}
+
+func TestPopReadonlyKeys(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	rfs.popOnRead = true
+	rfs.readonlyKeys = []string{"config:*"}
+	mr.Set("config:a", "v")
+	mr.RPush("config:l", "x")
+	root := rootDir(t, rfs)
+
+	for _, name := range []string{"config:a", "config:l"} {
+		readFile(t, lookupFile(t, root, name))
+		if !mr.Exists(name) {
+			t.Fatalf("reading protected %s popped it", name)
+		}
+	}
+}
+
+func TestNoCommitTruncate(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	rfs.noCommit = true
+	mr.Set("k", "precious")
+	f := lookupFile(t, rootDir(t, rfs), "k")
+
+	if err := truncate(t, f, 0); err != nil {
+		t.Fatal(err)
+	}
+	h, err := openTrunc(t, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(t, h, 0, "x")
+	closeHandle(t, h)
+
+	if got, _ := mr.Get("k"); got != "precious" {
+		t.Fatalf("k = %q with -no-commit", got)
+	}
+}
+
+func TestRenameTypeSuffix(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	rfs.typeSuffix = true
+	mr.RPush("x", "a")
+	mr.RPush("z", "old")
+	root := rootDir(t, rfs)
+	ctx := context.Background()
+
+	for _, c := range []struct{ from, to, key string }{
+		{"x.list", "y.list", "y"},
+		// onto an existing list
+		{"y.list", "z.list", "z"},
+		// and back under a plain name
+		{"z.list", "x", "x"},
+	} {
+		if err := root.Rename(ctx, &fuse.RenameRequest{OldName: c.from, NewName: c.to}, root); err != nil {
+			t.Fatalf("mv %s %s: %v", c.from, c.to, err)
+		}
+		if l, _ := mr.List(c.key); !slices.Equal(l, []string{"a"}) {
+			t.Fatalf("mv %s %s: %s = %q", c.from, c.to, c.key, l)
+		}
+	}
+	if keys := mr.Keys(); !slices.Equal(keys, []string{"x"}) {
+		t.Fatalf("keys = %q", keys)
+	}
+	if got := slices.DeleteFunc(dirNames(t, root), func(name string) bool {
+		return strings.HasPrefix(name, ".")
+	}); !slices.Equal(got, []string{"x.list"}) {
+		t.Fatalf("root = %q", got)
+	}
+
+	// -hash-format json hashes, like -enable-rejson documents, are .json
+	rfs, mr = newTestFS(t)
+	rfs.hashFormat = "json"
+	rfs.rejson = true
+	mr.HSet("a", "f", "v")
+	root = rootDir(t, rfs)
+	if err := root.Rename(ctx, &fuse.RenameRequest{OldName: "a.json", NewName: "b.json"}, root); err != nil {
+		t.Fatal(err)
+	}
+	if keys := mr.Keys(); !slices.Equal(keys, []string{"b"}) || mr.HGet("b", "f") != "v" {
+		t.Fatalf("keys after mv a.json b.json = %q", keys)
+	}
+	if got := slices.DeleteFunc(dirNames(t, root), func(name string) bool {
+		return strings.HasPrefix(name, ".")
+	}); !slices.Equal(got, []string{"b.json"}) {
+		t.Fatalf("root = %q", got)
+	}
+	if suffix := root.nameSuffix(rejsonType); suffix != ".json" {
+		t.Fatalf("ReJSON documents are named with %q", suffix)
+	}
+}
+
+func TestCurrent(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	rfs.prefix = "app:"
+	rfs.exclude = []string{"app:secret*"}
+	mr.Set("app:k", "value")
+	mr.Set("k", "outside the prefix")
+	mr.Set("app:secret", "hidden")
+	root := rootDir(t, rfs)
+
+	rfs.selectKey("k")
+	if got := readFile(t, lookupFile(t, root, currentName)); got != "value" {
+		t.Fatalf("current = %q, want app:k", got)
+	}
+
+	rfs.selectKey("secret")
+	if _, err := root.Lookup(context.Background(), currentName); err != syscall.ENOENT {
+		t.Fatalf("current for an excluded key = %v, want ENOENT", err)
+	}
+	if slices.Contains(dirNames(t, root), currentName) {
+		t.Fatal("current listed for an excluded key")
+	}
+}
+
+func TestOptimisticLocking(t *testing.T) {
+	ctx := context.Background()
+	rfs, mr := newTestFS(t)
+	rfs.optimistic = true
+	mr.Set("k", strings.Repeat("x", 1<<20))
+	f := lookupFile(t, rootDir(t, rfs), "k")
+
+	// the open takes a digest, not the value
+	log := &cmdLog{}
+	rfs.client.AddHook(log)
+	h := open(t, f, fuse.OpenWriteOnly)
+	if slices.Contains(log.names, "get") {
+		t.Fatalf("open sent GET, commands %v", log.names)
+	}
+	if h.base == nil || !h.base.exists {
+		t.Fatalf("open recorded no version: %v", h.base)
+	}
+
+	mr.Set("k", "other")
+	write(t, h, 0, "mine")
+	if err := h.Flush(ctx, &fuse.FlushRequest{}); err != syscall.EAGAIN {
+		t.Fatalf("flush over a changed key = %v, want EAGAIN", err)
+	}
+	h.Release(ctx, &fuse.ReleaseRequest{})
+	if v, _ := mr.Get("k"); v != "other" {
+		t.Fatalf("k = %q, want the concurrent value", v)
+	}
+
+	// a handle opened after the change, and its later flushes, go through
+	h = open(t, f, fuse.OpenWriteOnly)
+	write(t, h, 0, "mine!")
+	if err := h.Flush(ctx, &fuse.FlushRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	write(t, h, 5, "!")
+	closeHandle(t, h)
+	if v, _ := mr.Get("k"); v != "mine!!" {
+		t.Fatalf("k = %q", v)
+	}
+
+	// as does one opened before the key exists
+	mr.Del("k")
+	h = open(t, f, fuse.OpenWriteOnly)
+	write(t, h, 0, "new")
+	closeHandle(t, h)
+	if v, _ := mr.Get("k"); v != "new" {
+		t.Fatalf("k = %q", v)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"syscall"
+)
+
+// rejsonType is what TYPE reports for RedisJSON documents, which are shown
+// as <key>.json files with -enable-rejson.
+const rejsonType = "ReJSON-RL"
+
+// getJSON renders the document at key indented for reading.
+func (f *redisFile) getJSON(ctx context.Context, key string) ([]byte, error) {
+
+	s, err := f.client.Do(ctx, "JSON.GET", key, "$").Text()
+	if err != nil {
+		return nil, err
+	}
+
+	// the $ path answers with an array of matches, the root is the only one
+	var docs []json.RawMessage
+	if err := json.Unmarshal([]byte(s), &docs); err != nil || len(docs) != 1 {
+		slog.Error("unexpected JSON.GET reply", "op", "Read:JSONGet", "key", key, "err", err)
+		return nil, syscall.EIO
+	}
+
+	var b bytes.Buffer
+	if err := json.Indent(&b, docs[0], "", "  "); err != nil {
+		return nil, err
+	}
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
+
+// setJSON replaces the document at key with wb.
+func (f *redisFile) setJSON(ctx context.Context, key string, wb []byte) error {
+
+	if !json.Valid(wb) {
+		return syscall.EINVAL
+	}
+
+	if err := f.client.Do(ctx, "JSON.SET", key, "$", string(wb)).Err(); err != nil {
+		slog.Error("redis command failed", "op", "Flush:JSONSet", "key", key, "err", err)
+		return errno(err)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// stubSentinel serves just enough of the Sentinel protocol over RESP2 to
+// point clients at master for every name.
+func stubSentinel(t *testing.T, master string) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	host, port, _ := net.SplitHostPort(master)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveSentinel(conn, host, port)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func serveSentinel(conn net.Conn, host, port string) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		cmd := strings.ToLower(args[0])
+		if cmd == "sentinel" && len(args) > 1 {
+			cmd += " " + strings.ToLower(args[1])
+		}
+
+		var reply string
+		switch cmd {
+		case "hello":
+			reply = "-ERR unknown command 'hello'\r\n"
+		case "ping":
+			reply = "+PONG\r\n"
+		case "sentinel get-master-addr-by-name":
+			reply = fmt.Sprintf("*2\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(host), host, len(port), port)
+		case "sentinel replicas", "sentinel slaves", "sentinel sentinels":
+			reply = "*0\r\n"
+		case "subscribe", "psubscribe":
+			reply = fmt.Sprintf("*3\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n:1\r\n", len(cmd), cmd, len(args[1]), args[1])
+		default:
+			reply = "+OK\r\n"
+		}
+		if _, err := conn.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+// readCommand reads one RESP array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("bad array header %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, fmt.Errorf("bad bulk header %q", line)
+		}
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		args[i] = string(b[:size])
+	}
+	return args, nil
+}
+
+func TestSentinel(t *testing.T) {
+	for _, readOnly := range []bool{false, true} {
+		mr := miniredis.RunT(t)
+		mr.Set("k", "v")
+
+		client, err := newRedisClient(&redis.UniversalOptions{
+			Addrs:      []string{stubSentinel(t, mr.Addr())},
+			MasterName: "mymaster",
+			ReadOnly:   readOnly,
+		}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := client.Get(context.Background(), "k").Result()
+		client.Close()
+		if err != nil || got != "v" {
+			t.Fatalf("read-only %v: GET k = %q, %v", readOnly, got, err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func server(addr, token string, rfs *redisFS) {
+	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+		defer cancel()
+
+		if err := rfs.client.Do(ctx, "ping").Err(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	http.HandleFunc("/invalidate", control(token, func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Query().Get("key")
+		if key == "" {
+			http.Error(w, "missing key", http.StatusBadRequest)
+			return
+		}
+		rfs.invalidate(key)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	http.HandleFunc("/invalidate-all", control(token, func(w http.ResponseWriter, r *http.Request) {
+		rfs.invalidateAll()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	http.HandleFunc("/select", control(token, func(w http.ResponseWriter, r *http.Request) {
+		// an empty key clears the selection
+		rfs.selectKey(r.URL.Query().Get("key"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	log.Fatal(http.ListenAndServe(addr, nil))
+}
+
+// control restricts a handler to POST and, if token is set, to requests
+// carrying it as a bearer token.
+func control(token string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if token != "" {
+			got := r.Header.Get("Authorization")
+			if subtle.ConstantTimeCompare([]byte(got), []byte("Bearer "+token)) != 1 {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		h(w, r)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"syscall"
+
+	"bazil.org/fuse/fs"
+)
+
+// lookupSidecar resolves key as the .dump or .expires sidecar of an
+// existing key, if those are enabled. Real keys named that way win.
+func (d *redisDir) lookupSidecar(ctx context.Context, key string) (fs.Node, error) {
+
+	var base string
+	var node func() fs.Node
+	switch {
+	case d.dumpFiles && strings.HasSuffix(key, dumpSuffix):
+		base = strings.TrimSuffix(key, dumpSuffix)
+		node = func() fs.Node { return &dumpFile{key: base, redisFS: d.redisFS} }
+	case d.expiresFiles && strings.HasSuffix(key, expiresSuffix):
+		base = strings.TrimSuffix(key, expiresSuffix)
+		node = func() fs.Node { return &expiresFile{key: base, redisFS: d.redisFS} }
+	default:
+		return nil, syscall.ENOENT
+	}
+
+	n, err := d.client.Exists(ctx, base).Result()
+	if err != nil {
+		return nil, errno(err)
+	}
+	if n == 0 {
+		return nil, syscall.ENOENT
+	}
+	return node(), nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// synthFile is a read-only file whose contents are generated on every read
+// rather than backed by a Redis key.
+type synthFile struct {
+	read func(ctx context.Context) ([]byte, error)
+	*redisFS
+}
+
+func (s *synthFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	b, err := s.read(ctx)
+	if err != nil {
+		return err
+	}
+	a.Valid = s.attrValidity
+	a.Size = uint64(len(b))
+	a.Mode = 0444
+	return nil
+}
+
+func (s *synthFile) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	resp.Flags |= fuse.OpenDirectIO
+	return s, nil
+}
+
+func (s *synthFile) ReadAll(ctx context.Context) ([]byte, error) {
+	return s.read(ctx)
+}
+
+// infoSections get their own .info.<section> file next to .info, which
+// holds the default INFO output.
+var infoSections = []string{"server", "clients", "memory", "persistence", "stats", "replication", "cpu", "keyspace"}
+
+// synthFiles returns the synthetic files shown at the mount root.
+func (rfs *redisFS) synthFiles() map[string]*synthFile {
+	files := map[string]*synthFile{
+		".db": {
+			read: func(ctx context.Context) ([]byte, error) {
+				return []byte(strconv.Itoa(rfs.db) + "\n"), nil
+			},
+			redisFS: rfs,
+		},
+		".dbsize": {
+			read: func(ctx context.Context) ([]byte, error) {
+				n, err := rfs.client.DBSize(ctx).Result()
+				if err != nil {
+					return nil, errno(err)
+				}
+				return []byte(strconv.FormatInt(n, 10) + "\n"), nil
+			},
+			redisFS: rfs,
+		},
+		".info": {
+			read: func(ctx context.Context) ([]byte, error) {
+				return rfs.info(ctx, "")
+			},
+			redisFS: rfs,
+		},
+	}
+	for _, section := range infoSections {
+		files[".info."+section] = &synthFile{
+			read: func(ctx context.Context) ([]byte, error) {
+				return rfs.info(ctx, section)
+			},
+			redisFS: rfs,
+		}
+	}
+	return files
+}
+
+type cachedInfo struct {
+	b  []byte
+	at time.Time
+}
+
+// info returns INFO output for section, "" for the default sections. It is
+// cached for -attr-validity so stat and read of a file agree.
+func (rfs *redisFS) info(ctx context.Context, section string) ([]byte, error) {
+
+	rfs.infoMu.Lock()
+	c, ok := rfs.infos[section]
+	rfs.infoMu.Unlock()
+	if ok && time.Since(c.at) < rfs.attrValidity {
+		return c.b, nil
+	}
+
+	var sections []string
+	if section != "" {
+		sections = append(sections, section)
+	}
+	s, err := rfs.client.Info(ctx, sections...).Result()
+	if err != nil {
+		return nil, errno(err)
+	}
+	// INFO separates lines with CRLF
+	b := []byte(strings.ReplaceAll(s, "\r\n", "\n"))
+
+	rfs.infoMu.Lock()
+	if rfs.infos == nil {
+		rfs.infos = make(map[string]cachedInfo)
+	}
+	rfs.infos[section] = cachedInfo{b: b, at: time.Now()}
+	rfs.infoMu.Unlock()
+	return b, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"syscall"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/redis/go-redis/v9"
+)
+
+// tailFileName is the synthetic file inside every stream directory that
+// follows the stream like tail -f.
+const tailFileName = ".tail"
+
+// tailFile streams entries added after it was opened, one compact JSON
+// message per line. A read that sees no new entry within tailBlock returns
+// EOF, so idle streams do not hang readers forever.
+type tailFile struct {
+	stream string
+	*redisFS
+}
+
+func (t *tailFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Valid = t.attrValidity
+	a.Mode = 0444
+	return nil
+}
+
+func (t *tailFile) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	if !req.Flags.IsReadOnly() {
+		return nil, syscall.EACCES
+	}
+
+	// resolve "$" now so entries added between reads are not skipped
+	last := "0-0"
+	msgs, err := t.client.XRevRangeN(ctx, t.stream, "+", "-", 1).Result()
+	if err != nil && err != redis.Nil {
+		slog.Error("redis command failed", "op", "Open:XRevRange", "key", t.stream, "err", err)
+		return nil, errno(err)
+	}
+	if len(msgs) > 0 {
+		last = msgs[0].ID
+	}
+
+	resp.Flags |= fuse.OpenDirectIO | fuse.OpenNonSeekable
+	return &tailHandle{t: t, last: last}, nil
+}
+
+type tailHandle struct {
+	t *tailFile
+
+	mu   sync.Mutex
+	last string
+	buf  []byte
+}
+
+func (h *tailHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) (err error) {
+	defer observeOp("tail", &err)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.buf) == 0 {
+		msgs, err := h.wait(ctx)
+		if err != nil {
+			return err
+		}
+		for i := range msgs {
+			// one compact line per entry whatever -stream-format says
+			b, err := json.Marshal(binarySafe(msgs[i]))
+			if err != nil {
+				return syscall.EIO
+			}
+			h.buf = append(h.buf, b...)
+			h.buf = append(h.buf, '\n')
+			h.last = msgs[i].ID
+		}
+	}
+
+	n := req.Size
+	if n > len(h.buf) {
+		n = len(h.buf)
+	}
+	resp.Data = append(resp.Data[:0], h.buf[:n]...)
+	h.buf = h.buf[n:]
+	return nil
+}
+
+// wait blocks in XREAD until new entries arrive, tailBlock elapses or the
+// reader goes away.
+func (h *tailHandle) wait(ctx context.Context) ([]redis.XMessage, error) {
+
+	type result struct {
+		streams []redis.XStream
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		// XREAD cannot be interrupted, the connection returns to the pool
+		// once the block times out
+		streams, err := h.t.client.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{h.t.stream, h.last},
+			Count:   h.t.scanCount,
+			Block:   h.t.tailBlock,
+		}).Result()
+		done <- result{streams, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, fuse.EINTR
+	case r := <-done:
+		if r.err == redis.Nil {
+			return nil, nil
+		}
+		if r.err != nil {
+			slog.Error("redis command failed", "op", "Read:XRead", "key", h.t.stream, "last", h.last, "err", r.err)
+			return nil, errno(r.err)
+		}
+		if len(r.streams) == 0 {
+			return nil, nil
+		}
+		return r.streams[0].Messages, nil
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"bazil.org/fuse"
+)
+
+func TestTailBinary(t *testing.T) {
+	rfs, mr := newTestFS(t)
+	rfs.streamFormat = "json-pretty"
+	rfs.tailBlock = time.Second
+	ctx := context.Background()
+
+	tf := &tailFile{stream: "s", redisFS: rfs}
+	h, err := tf.Open(ctx, &fuse.OpenRequest{Flags: fuse.OpenReadOnly}, &fuse.OpenResponse{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mr.XAdd("s", "1-1", []string{"v", "\xff\x00"}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := &fuse.ReadResponse{Data: make([]byte, 0, 4096)}
+	if err := h.(*tailHandle).Read(ctx, &fuse.ReadRequest{Size: 4096}, resp); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(resp.Data); !strings.Contains(got, `"Values":{"v":{"base64":"/wA="}}`) || strings.Count(got, "\n") != 1 {
+		t.Fatalf("tail = %q", got)
+	}
+}
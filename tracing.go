@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracing is set once an exporter is configured, until then spans are never
+// started and cost a single branch.
+var tracing bool
+
+var tracer = otel.Tracer("github.com/ppai-plivo/rsfs")
+
+// setupTracing exports spans over OTLP/HTTP to endpoint, a URL such as
+// http://localhost:4318. The returned function flushes pending spans.
+func setupTracing(endpoint string) (func(context.Context) error, error) {
+
+	exp, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("otel exporter: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "rsfs"))),
+	)
+	otel.SetTracerProvider(tp)
+	tracing = true
+
+	return tp.Shutdown, nil
+}
+
+// startSpan starts a span for a FUSE operation on key. Use it as
+//
+//	ctx, span := startSpan(ctx, "Op", key)
+//	defer func() { endSpan(span, err) }()
+func startSpan(ctx context.Context, op, key string) (context.Context, trace.Span) {
+	if !tracing {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	return tracer.Start(ctx, op, trace.WithAttributes(attribute.String("rsfs.key", key)))
+}
+
+func endSpan(span trace.Span, err error, attrs ...attribute.KeyValue) {
+	if !span.IsRecording() {
+		return
+	}
+	span.SetAttributes(attrs...)
+	if err != nil && err != redis.Nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tracingHook adds a child span for every redis command and pipeline.
+type tracingHook struct{}
+
+func (tracingHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (tracingHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		// the key is on the parent span, the arguments may hold values
+		ctx, span := tracer.Start(ctx, "redis "+cmd.Name(), trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+			attribute.String("db.system", "redis"),
+			attribute.String("db.operation", cmd.Name()),
+		))
+		err := next(ctx, cmd)
+		endSpan(span, cmd.Err())
+		return err
+	}
+}
+
+func (tracingHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		ctx, span := tracer.Start(ctx, "redis pipeline", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+			attribute.String("db.system", "redis"),
+			attribute.Int("db.redis.num_cmd", len(cmds)),
+		))
+		err := next(ctx, cmds)
+		endSpan(span, err)
+		return err
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// watchRescan is how often the masters of a cluster are listed again, so
+// masters promoted by a failover or added by a reshard are followed too.
+const watchRescan = 30 * time.Second
+
+// watchKeyspace drops cached types and contents of keys as Redis reports
+// them changed. It needs notify-keyspace-events to include E and the event
+// classes of interest, e.g. "Eg$lshzxt" or "EA".
+func (rfs *redisFS) watchKeyspace() {
+
+	ctx := context.Background()
+	cc, ok := rfs.client.(*redis.ClusterClient)
+	if !ok {
+		rfs.watchNode(ctx, rfs.client)
+		return
+	}
+
+	// events are published on the node owning the key, follow every master
+	watched := make(map[string]context.CancelFunc)
+	for {
+		rfs.watchMasters(ctx, cc, watched)
+		time.Sleep(watchRescan)
+	}
+}
+
+// watchMasters starts watching the masters of cc not in watched yet and
+// stops watching nodes that are no longer masters.
+func (rfs *redisFS) watchMasters(ctx context.Context, cc *redis.ClusterClient, watched map[string]context.CancelFunc) {
+
+	cc.ReloadState(ctx)
+
+	var mu sync.Mutex
+	masters := make(map[string]*redis.Client)
+	err := cc.ForEachMaster(ctx, func(_ context.Context, node *redis.Client) error {
+		mu.Lock()
+		masters[node.Options().Addr] = node
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		slog.Warn("redis command failed", "op", "Watch:ForEachMaster", "err", err)
+		return
+	}
+
+	for addr, cancel := range watched {
+		if _, ok := masters[addr]; !ok {
+			cancel()
+			delete(watched, addr)
+		}
+	}
+	for addr, node := range masters {
+		if _, ok := watched[addr]; ok {
+			continue
+		}
+		nctx, cancel := context.WithCancel(ctx)
+		watched[addr] = cancel
+		go rfs.watchNode(nctx, node)
+	}
+}
+
+func (rfs *redisFS) watchNode(ctx context.Context, c redis.UniversalClient) {
+
+	pubsub := c.PSubscribe(ctx, fmt.Sprintf("__keyevent@%d__:*", rfs.db))
+	defer pubsub.Close()
+
+	for {
+		msg, err := pubsub.Receive(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			// the next Receive reconnects and resubscribes
+			slog.Warn("redis command failed", "op", "Watch:Receive", "err", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		switch m := msg.(type) {
+		case *redis.Subscription:
+			// events may have been missed while disconnected
+			rfs.invalidateAll()
+		case *redis.Message:
+			rfs.invalidate(m.Payload)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"bazil.org/fuse"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	xattrTTL      = "user.ttl"
+	xattrStreamID = "user.stream_id"
+	xattrEncoding = "user.encoding"
+	xattrRefcount = "user.refcount"
+	xattrFreq     = "user.freq"
+	xattrBitcount = "user.bitcount"
+	// xattrBitPrefix followed by an offset reads that bit with GETBIT
+	xattrBitPrefix = "user.bit."
+)
+
+// keyXattrs are available on every node backed by a whole Redis key.
+var keyXattrs = []string{xattrTTL, xattrEncoding, xattrRefcount, xattrFreq}
+
+// keyXattr reads one of keyXattrs for key.
+func (rfs *redisFS) keyXattr(ctx context.Context, key, name string) ([]byte, error) {
+
+	var n int64
+	var err error
+	switch name {
+	case xattrTTL:
+		var ttl time.Duration
+		ttl, err = rfs.client.TTL(ctx, key).Result()
+		if err != nil {
+			break
+		}
+		switch ttl {
+		case -2:
+			return nil, syscall.ENOENT
+		case -1:
+			return []byte("-1"), nil
+		}
+		n = int64(ttl / time.Second)
+	case xattrEncoding:
+		var enc string
+		enc, err = rfs.client.ObjectEncoding(ctx, key).Result()
+		if err == nil {
+			return []byte(enc), nil
+		}
+	case xattrRefcount:
+		n, err = rfs.client.ObjectRefCount(ctx, key).Result()
+	case xattrFreq:
+		n, err = rfs.client.ObjectFreq(ctx, key).Result()
+		if err != nil && err != redis.Nil {
+			// only available under an LFU maxmemory-policy
+			return nil, fuse.ErrNoXattr
+		}
+	default:
+		return nil, fuse.ErrNoXattr
+	}
+	if err == redis.Nil {
+		return nil, syscall.ENOENT
+	}
+	if err != nil {
+		return nil, errno(err)
+	}
+
+	return []byte(strconv.FormatInt(n, 10)), nil
+}
+
+// bitXattr reads the population count or a single bit of a string key used
+// as a bitmap.
+func (rfs *redisFS) bitXattr(ctx context.Context, key, name string) ([]byte, error) {
+
+	var n int64
+	var err error
+	if name == xattrBitcount {
+		n, err = rfs.client.BitCount(ctx, key, nil).Result()
+	} else {
+		off, perr := strconv.ParseInt(strings.TrimPrefix(name, xattrBitPrefix), 10, 64)
+		if perr != nil || off < 0 {
+			return nil, fuse.ErrNoXattr
+		}
+		n, err = rfs.client.GetBit(ctx, key, off).Result()
+	}
+	if err != nil {
+		return nil, errno(err)
+	}
+
+	return []byte(strconv.FormatInt(n, 10)), nil
+}
+
+func (f *redisFile) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
+	switch f.pt {
+	case "":
+		// only top-level keys carry their own expiry and object info
+		resp.Append(keyXattrs...)
+		if f.t == "string" {
+			resp.Append(xattrBitcount)
+		}
+	case "stream":
+		resp.Append(xattrStreamID)
+	}
+	return nil
+}
+
+func (f *redisFile) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
+
+	if f.pt == "stream" && req.Name == xattrStreamID {
+		// entries written as "*" only learn their ID once flushed
+		f.mu.RLock()
+		id := f.id
+		f.mu.RUnlock()
+		if id == "" {
+			id = f.name
+		}
+		resp.Xattr = []byte(id)
+		return nil
+	}
+
+	if f.pt != "" {
+		return fuse.ErrNoXattr
+	}
+
+	var b []byte
+	var err error
+	if f.t == "string" && (req.Name == xattrBitcount || strings.HasPrefix(req.Name, xattrBitPrefix)) {
+		b, err = f.bitXattr(ctx, f.name, req.Name)
+	} else {
+		b, err = f.keyXattr(ctx, f.name, req.Name)
+	}
+	if err != nil {
+		return err
+	}
+	resp.Xattr = b
+	return nil
+}
+
+func (d *redisDir) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
+	if !d.root && d.name != "" {
+		resp.Append(keyXattrs...)
+	}
+	return nil
+}
+
+func (d *redisDir) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
+	if d.root || d.name == "" {
+		return fuse.ErrNoXattr
+	}
+
+	b, err := d.keyXattr(ctx, d.name, req.Name)
+	if err != nil {
+		return err
+	}
+	resp.Xattr = b
+	return nil
+}
+
+func (f *redisFile) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) error {
+
+	if f.pt != "" || req.Name != xattrTTL {
+		return syscall.ENOTSUP
+	}
+	if f.immutable() {
+		return syscall.EROFS
+	}
+
+	secs, err := strconv.ParseInt(strings.TrimSpace(string(req.Xattr)), 10, 64)
+	if err != nil || secs <= 0 {
+		// EXPIRE with a non-positive value deletes the key, never allow that here
+		return syscall.EINVAL
+	}
+
+	ok, err := f.client.Expire(ctx, f.name, time.Duration(secs)*time.Second).Result()
+	if err != nil {
+		return errno(err)
+	}
+	if !ok {
+		return syscall.ENOENT
+	}
+
+	return nil
+}
+
+func (f *redisFile) Removexattr(ctx context.Context, req *fuse.RemovexattrRequest) error {
+
+	if f.pt != "" || req.Name != xattrTTL {
+		return fuse.ErrNoXattr
+	}
+	if f.immutable() {
+		return syscall.EROFS
+	}
+
+	if _, err := f.client.Persist(ctx, f.name).Result(); err != nil {
+		return errno(err)
+	}
+
+	return nil
+}